@@ -0,0 +1,73 @@
+package key_wrapper
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// pollSchedule computes the delay before the next check of the Interrogator.
+// After a successful check it is Interval, spread by IntervalJitter so that
+// many instances do not poll in lockstep. After consecutive source failures
+// it is an exponential backoff with full jitter: a random delay between zero
+// and Interval * 2^failures, capped at MaxBackoff.
+type pollSchedule struct {
+	interval   time.Duration  // delay after a successful check
+	jitter     float64        // fraction of interval the delay may deviate by
+	maxBackoff time.Duration  // upper bound of the backoff, 0 disables backoff
+	failures   int            // number of consecutive failed checks
+	rand       func() float64 // returns a random number in [0, 1)
+}
+
+// pollScheduleSeeds counts the created poll schedules.
+var pollScheduleSeeds int64
+
+// newPollSchedule creates the poll schedule configured by cfg.
+// Every schedule seeds its own random source, since the global one starts
+// with the same seed in every process before Go 1.20 and would make many
+// instances draw the same delays. The schedule is only used by the run
+// goroutine, so the source needs no locking.
+func newPollSchedule(cfg *Config) *pollSchedule {
+	// the counter keeps the seeds of schedules created at the same time apart
+	seed := time.Now().UnixNano() + atomic.AddInt64(&pollScheduleSeeds, 1)
+	rnd := rand.New(rand.NewSource(seed))
+
+	return &pollSchedule{
+		interval:   cfg.Interval,
+		jitter:     cfg.IntervalJitter,
+		maxBackoff: cfg.MaxBackoff,
+		rand:       rnd.Float64,
+	}
+}
+
+// next returns the delay before the next check, given whether the last
+// check failed. A successful check resets the backoff.
+func (s *pollSchedule) next(failed bool) time.Duration {
+	if !failed || s.maxBackoff <= 0 {
+		s.failures = 0
+		return s.jittered()
+	}
+
+	s.failures++
+
+	ceiling := s.interval
+	for i := 0; i < s.failures && ceiling < s.maxBackoff; i++ {
+		ceiling *= 2
+	}
+
+	if ceiling > s.maxBackoff {
+		ceiling = s.maxBackoff
+	}
+
+	return time.Duration(s.rand() * float64(ceiling))
+}
+
+// jittered returns the interval spread uniformly by the jitter fraction
+// in both directions, so the average delay stays the interval.
+func (s *pollSchedule) jittered() time.Duration {
+	if s.jitter <= 0 {
+		return s.interval
+	}
+
+	return time.Duration(float64(s.interval) * (1 + s.jitter*(2*s.rand()-1)))
+}
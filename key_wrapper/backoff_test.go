@@ -0,0 +1,137 @@
+package key_wrapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPollSchedule_Next(t *testing.T) {
+	t.Run("interval without jitter", func(t *testing.T) {
+		s := &pollSchedule{interval: time.Second, rand: func() float64 { return 0.5 }}
+
+		for i := 0; i < 3; i++ {
+			if got := s.next(false); got != time.Second {
+				t.Fatalf("got=%s, exp=1s", got)
+			}
+		}
+
+		// without MaxBackoff failures keep the interval
+		if got := s.next(true); got != time.Second {
+			t.Fatalf("got=%s, exp=1s", got)
+		}
+	})
+
+	t.Run("interval jitter", func(t *testing.T) {
+		r := 0.0
+		s := &pollSchedule{interval: time.Second, jitter: 0.2, rand: func() float64 { return r }}
+
+		tests := map[float64]time.Duration{
+			0:    800 * time.Millisecond,
+			0.5:  time.Second,
+			0.75: 1100 * time.Millisecond,
+		}
+
+		for value, exp := range tests {
+			r = value
+			if got := s.next(false); got != exp {
+				t.Fatalf("rand %v: got=%s, exp=%s", value, got, exp)
+			}
+		}
+	})
+
+	t.Run("exponential backoff with full jitter", func(t *testing.T) {
+		r := 0.999999
+		s := &pollSchedule{
+			interval:   time.Second,
+			maxBackoff: 10 * time.Second,
+			rand:       func() float64 { return r },
+		}
+
+		// ceilings 2s, 4s, 8s, then capped at 10s
+		for _, ceiling := range []time.Duration{2, 4, 8, 10, 10} {
+			got := s.next(true)
+			if got >= ceiling*time.Second || got < ceiling*time.Second-time.Millisecond {
+				t.Fatalf("got=%s, exp just below %s", got, ceiling*time.Second)
+			}
+		}
+
+		// full jitter may pick any delay down to zero
+		r = 0
+		if got := s.next(true); got != 0 {
+			t.Fatalf("got=%s, exp=0s", got)
+		}
+
+		// success resets the backoff
+		if got := s.next(false); got != time.Second {
+			t.Fatalf("got=%s, exp=1s", got)
+		}
+
+		r = 0.5
+		if got := s.next(true); got != time.Second {
+			t.Fatalf("got=%s, exp=1s", got)
+		}
+	})
+
+	t.Run("long outage does not overflow", func(t *testing.T) {
+		s := &pollSchedule{
+			interval:   time.Hour,
+			maxBackoff: 24 * time.Hour,
+			rand:       func() float64 { return 0.5 },
+		}
+
+		for i := 0; i < 100; i++ {
+			if got := s.next(true); got <= 0 || got > 24*time.Hour {
+				t.Fatalf("failure %d: got=%s", i+1, got)
+			}
+		}
+	})
+	t.Run("schedules draw different delays", func(t *testing.T) {
+		cfg := &Config{Interval: time.Second, IntervalJitter: 0.5}
+		a, b := newPollSchedule(cfg), newPollSchedule(cfg)
+
+		same := true
+		for i := 0; i < 5; i++ {
+			if a.next(false) != b.next(false) {
+				same = false
+			}
+		}
+
+		if same {
+			t.Fatal("expected schedules with different random sources")
+		}
+	})
+}
+
+func TestInterrogator_CheckAndUpdateFailed(t *testing.T) {
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	var countErr error
+	cfg := &Config{
+		GetShardsCount: func() (int, error) { return 2, countErr },
+		GetShardIDs:    func() ([]string, error) { return []string{"a"}, nil },
+		Factory:        f,
+		ErrorHandler:   func(err error) {},
+	}
+
+	if _, failed := (&Interrogator{}).checkAndUpdate(context.Background(), cfg); failed {
+		t.Fatal("expected no failure")
+	}
+
+	countErr = errors.New("source is down")
+	if _, failed := (&Interrogator{}).checkAndUpdate(context.Background(), cfg); !failed {
+		t.Fatal("expected failure")
+	}
+
+	// factory errors are not source failures
+	countErr = nil
+	cfg.GetShardsCount = func() (int, error) { return -1, nil }
+
+	if _, failed := (&Interrogator{}).checkAndUpdate(context.Background(), cfg); failed {
+		t.Fatal("expected no failure")
+	}
+}
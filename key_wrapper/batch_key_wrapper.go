@@ -0,0 +1,92 @@
+package key_wrapper
+
+// BatchMode selects how WrapKeys assigns shards to a batch of keys.
+type BatchMode int
+
+const (
+	// BatchRotating continues the wrapper's rotation across the batch,
+	// as if WrapKey was called for every key in order.
+	BatchRotating BatchMode = iota
+	// BatchShared gives all keys of the batch the same postfix, for atomic
+	// multi-key operations. The rotation advances once per batch.
+	BatchShared
+)
+
+// ShardKeys is a group of wrapped keys that belong to the same shard.
+type ShardKeys struct {
+	Shard   int      // 1-based shard number of the group
+	Keys    []string // wrapped keys in input order
+	Indexes []int    // positions of the keys in the input slice, aligned with Keys
+}
+
+// BatchKeyWrapper is a KeyWrapper that can wrap a batch of keys with a single
+// synchronized update of its rotation. The result is grouped by shard, so a pipeline can be split
+// per shard without parsing the wrapped keys again.
+//
+// The wrappers returned by MakeKeyWrapper, MakeOnlyGrowingKeyWrapper and
+// MakeWeightedKeyWrapper implement BatchKeyWrapper:
+//
+//	bw := factory.MakeKeyWrapper().(key_wrapper.BatchKeyWrapper)
+//	for _, group := range bw.WrapKeys(keys, key_wrapper.BatchRotating) {
+//		pipeline := pipelines[group.Shard]
+//		...
+//	}
+type BatchKeyWrapper interface {
+	KeyWrapper
+	// WrapKeys wraps all keys in the given mode and returns them grouped
+	// by shard, ordered by shard number. It returns nil for no keys.
+	WrapKeys(keys []string, mode BatchMode) []ShardKeys
+}
+
+// Compile-time interface compliance checks
+var _ BatchKeyWrapper = (*keyWrapper)(nil)
+var _ BatchKeyWrapper = (*weightedKeyWrapper)(nil)
+
+// groupByShard wraps keys[i] with the postfix of shards[i] and groups
+// the wrapped keys by shard, ordered by shard number.
+func groupByShard(format Formatter, keys []string, shards []int) []ShardKeys {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var maxShard int
+	for _, shard := range shards {
+		if shard > maxShard {
+			maxShard = shard
+		}
+	}
+
+	// count the keys of every shard first to allocate the groups exactly
+	counts := make([]int, maxShard+1)
+	for _, shard := range shards {
+		counts[shard]++
+	}
+
+	var (
+		groups  []ShardKeys
+		affixes []string // postfix of every group, rendered once per batch
+	)
+
+	for shard, count := range counts {
+		if count == 0 {
+			continue
+		}
+
+		counts[shard] = len(groups) // reused as the position of the group
+		groups = append(groups, ShardKeys{
+			Shard:   shard,
+			Keys:    make([]string, 0, count),
+			Indexes: make([]int, 0, count),
+		})
+		affixes = append(affixes, format.affix(shard))
+	}
+
+	for i, key := range keys {
+		pos := counts[shards[i]]
+		g := &groups[pos]
+		g.Keys = append(g.Keys, format.attach(key, affixes[pos]))
+		g.Indexes = append(g.Indexes, i)
+	}
+
+	return groups
+}
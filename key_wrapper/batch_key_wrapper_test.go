@@ -0,0 +1,100 @@
+package key_wrapper
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestKeyWrapper_WrapKeys(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	t.Run("rotating", func(t *testing.T) {
+		kw := newKeyWrapper(3, Formatter{})
+
+		got := kw.WrapKeys(keys, BatchRotating)
+		exp := []ShardKeys{
+			{Shard: 1, Keys: []string{"a:1", "d:1"}, Indexes: []int{0, 3}},
+			{Shard: 2, Keys: []string{"b:2", "e:2"}, Indexes: []int{1, 4}},
+			{Shard: 3, Keys: []string{"c:3"}, Indexes: []int{2}},
+		}
+
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got=%v, exp=%v", got, exp)
+		}
+
+		// the rotation continues after the batch
+		if got := kw.WrapKey("key"); got != "key:3" {
+			t.Fatalf("got=%s, exp=key:3", got)
+		}
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		kw := newKeyWrapper(3, Formatter{})
+
+		for shard := 1; shard <= 4; shard++ {
+			exp := (shard-1)%3 + 1
+
+			got := kw.WrapKeys(keys, BatchShared)
+			if len(got) != 1 || got[0].Shard != exp {
+				t.Fatalf("got=%v, exp shard %d", got, exp)
+			}
+
+			for i, key := range got[0].Keys {
+				if key != keys[i]+":"+strconv.Itoa(exp) {
+					t.Fatalf("got=%s, exp=%s:%d", key, keys[i], exp)
+				}
+			}
+		}
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		kw := newKeyWrapper(3, Formatter{})
+
+		if got := kw.WrapKeys(nil, BatchShared); got != nil {
+			t.Fatalf("got=%v, exp=nil", got)
+		}
+
+		// an empty batch does not advance the rotation
+		if got := kw.WrapKey("key"); got != "key:1" {
+			t.Fatalf("got=%s, exp=key:1", got)
+		}
+	})
+}
+
+func TestWeightedKeyWrapper_WrapKeys(t *testing.T) {
+	kw := newWeightedKeyWrapper([]int{5, 1, 1}, Formatter{})
+
+	keys := []string{"a", "b", "c", "d", "e", "f", "g"}
+
+	got := kw.WrapKeys(keys, BatchRotating)
+	exp := []ShardKeys{
+		{Shard: 1, Keys: []string{"a:1", "b:1", "d:1", "f:1", "g:1"}, Indexes: []int{0, 1, 3, 5, 6}},
+		{Shard: 2, Keys: []string{"c:2"}, Indexes: []int{2}},
+		{Shard: 3, Keys: []string{"e:3"}, Indexes: []int{4}},
+	}
+
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got=%v, exp=%v", got, exp)
+	}
+
+	shared := kw.WrapKeys(keys, BatchShared)
+	if len(shared) != 1 || len(shared[0].Keys) != len(keys) {
+		t.Fatalf("expected one group of %d keys, got %v", len(keys), shared)
+	}
+}
+
+func BenchmarkWrapKeys(b *testing.B) {
+	factory, _ := NewFactory(10)
+	wrapper := factory.MakeKeyWrapper().(BatchKeyWrapper)
+
+	keys := make([]string, 16)
+	for i := range keys {
+		keys[i] = "testkey" + strconv.Itoa(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wrapper.WrapKeys(keys, BatchRotating)
+	}
+}
@@ -0,0 +1,69 @@
+package key_wrapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// NoFallback can be passed to NewFactoryFromSource as the fallback shard count
+// to return the error of a failed query instead of starting with a fallback.
+const NoFallback = -1
+
+// FallbackError is returned by NewFactoryFromSource together with a usable
+// factory when the shard count query failed and the factory was started with
+// the fallback shard count, so the caller can log or alert on it.
+// Err is the reason of the failure and can be checked with errors.Is.
+type FallbackError struct {
+	Fallback int   // shard count the factory was started with
+	Err      error // the reason the query failed
+}
+
+// Error implements the error interface.
+func (e *FallbackError) Error() string {
+	return fmt.Sprintf("query shards count: %v; started with fallback of %d shards",
+		e.Err, e.Fallback)
+}
+
+// Unwrap returns the reason the query failed.
+func (e *FallbackError) Unwrap() error {
+	return e.Err
+}
+
+// NewFactoryFromSource creates a new Factory whose initial shard count is
+// queried synchronously from source, so the first wrapped key already uses
+// the current shard count instead of a hardcoded one.
+//
+// The query is bounded by ctx and, when greater than zero, by timeout.
+// If the query fails or returns an invalid shard count, the factory starts
+// with fallbackShardsCount, which may be any valid shard count including 0,
+// and the Interrogator corrects it later. The factory is then returned
+// together with a *FallbackError describing the failure. With NoFallback
+// only the error is returned.
+func NewFactoryFromSource(
+	ctx context.Context,
+	source ShardsCountSource,
+	timeout time.Duration,
+	fallbackShardsCount int,
+	opts ...FactoryOption,
+) (*Factory, error) {
+	count, err := fetchShardsCount(ctx, source, timeout)
+	if err == nil {
+		err = validateShardsCount(count)
+	}
+
+	if err == nil {
+		return NewFactory(count, opts...)
+	}
+
+	if fallbackShardsCount == NoFallback {
+		return nil, fmt.Errorf("query shards count: %w", err)
+	}
+
+	f, factoryErr := NewFactory(fallbackShardsCount, opts...)
+	if factoryErr != nil {
+		return nil, factoryErr
+	}
+
+	return f, &FallbackError{Fallback: fallbackShardsCount, Err: err}
+}
@@ -0,0 +1,107 @@
+package key_wrapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewFactoryFromSource(t *testing.T) {
+	errSource := errors.New("source is down")
+
+	hung := ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	t.Run("uses the source count", func(t *testing.T) {
+		f, err := NewFactoryFromSource(context.Background(), ShardsCountFunc(func() (int, error) {
+			return 5, nil
+		}), time.Second, 2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		if got := f.Stats().Shards; got != 5 {
+			t.Fatalf("got=%d, exp=5", got)
+		}
+
+		if got := f.MakeKeyWrapper().WrapKey("key"); got != "key:1" {
+			t.Fatalf("got=%s, exp=key:1", got)
+		}
+	})
+
+	t.Run("falls back", func(t *testing.T) {
+		sources := map[string]ShardsCountSource{
+			"error":         ShardsCountFunc(func() (int, error) { return 0, errSource }),
+			"invalid count": ShardsCountFunc(func() (int, error) { return -1, nil }),
+			"timeout":       hung,
+		}
+
+		_, err := NewFactoryFromSource(context.Background(), sources["error"], 0, 2)
+		if !errors.Is(err, errSource) {
+			t.Fatalf("got=%v, exp=%v", err, errSource)
+		}
+
+		for name, source := range sources {
+			f, err := NewFactoryFromSource(context.Background(), source, time.Millisecond, 2)
+
+			var fallbackErr *FallbackError
+			if !errors.As(err, &fallbackErr) || fallbackErr.Fallback != 2 {
+				t.Fatalf("%s: got=%v, exp a fallback error", name, err)
+			}
+
+			if f == nil {
+				t.Fatalf("%s: expected factory with the fallback error", name)
+			}
+
+			if got := f.Stats().Shards; got != 2 {
+				t.Fatalf("%s: got=%d, exp=2", name, got)
+			}
+		}
+	})
+
+	t.Run("without fallback", func(t *testing.T) {
+		_, err := NewFactoryFromSource(context.Background(), ShardsCountFunc(func() (int, error) {
+			return 0, errSource
+		}), 0, NoFallback)
+		if !errors.Is(err, errSource) {
+			t.Fatalf("got=%v, exp=%v", err, errSource)
+		}
+
+		_, err = NewFactoryFromSource(context.Background(), hung, time.Millisecond, NoFallback)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got=%v, exp=%v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("zero fallback", func(t *testing.T) {
+		f, err := NewFactoryFromSource(context.Background(), ShardsCountFunc(func() (int, error) {
+			return 0, errSource
+		}), 0, 0)
+
+		var fallbackErr *FallbackError
+		if !errors.As(err, &fallbackErr) {
+			t.Fatalf("got=%v, exp a fallback error", err)
+		}
+
+		if got := f.Stats().Shards; got != 0 {
+			t.Fatalf("got=%d, exp=0", got)
+		}
+	})
+
+	t.Run("invalid fallback", func(t *testing.T) {
+		f, err := NewFactoryFromSource(context.Background(), ShardsCountFunc(func() (int, error) {
+			return 0, errSource
+		}), 0, maxShardsCount+1)
+		if err == nil || f != nil {
+			t.Fatalf("got factory=%v err=%v, exp only an error", f, err)
+		}
+
+		var fallbackErr *FallbackError
+		if errors.As(err, &fallbackErr) {
+			t.Fatalf("got=%v, exp a factory error", err)
+		}
+	})
+}
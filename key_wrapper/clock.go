@@ -0,0 +1,53 @@
+package key_wrapper
+
+import (
+	"time"
+)
+
+// Clock provides the current time to the Factory and timers to the Interrogator.
+// The default clock uses the time package; tests can set WithClock or
+// Config.Clock to a fake clock, such as clocktest.FakeClock, to control
+// time step by step.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer creates a new Timer that sends the current time
+	// on its channel after at least duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event timer created by a Clock.
+// It follows the semantics of time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing and reports whether it was active.
+	Stop() bool
+	// Reset changes the timer to fire after duration d
+	// and reports whether it was active.
+	Reset(d time.Duration) bool
+}
+
+// Compile-time interface compliance checks
+var _ Clock = realClock{}
+var _ Timer = realTimer{}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// realTimer is the Timer backed by time.Timer.
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
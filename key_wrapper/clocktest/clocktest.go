@@ -0,0 +1,202 @@
+// Package clocktest provides a fake key_wrapper.Clock for deterministic tests
+// of time-based behavior, such as the checks of the Interrogator.
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/releaseband/wrappers/v2/key_wrapper"
+)
+
+// Compile-time interface compliance checks
+var _ key_wrapper.Clock = (*FakeClock)(nil)
+var _ key_wrapper.Timer = (*fakeTimer)(nil)
+
+// FakeClock is a key_wrapper.Clock whose time only moves when Advance is called.
+// Timers fire synchronously within Advance once their deadline is reached.
+//
+// A typical test waits until the code under test has armed its timer,
+// advances the clock and observes the effect:
+//
+//	clock := clocktest.NewFakeClock(time.Unix(0, 0))
+//	cfg.Clock = clock
+//	srv, _ := key_wrapper.RunInterrogator(cfg)
+//
+//	clock.BlockUntil(1)         // the first check is scheduled
+//	clock.Advance(cfg.Interval) // the first check runs
+//	clock.BlockUntil(1)         // the check is done and the next one is scheduled
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond   // signaled whenever timers are armed or stopped
+	now    time.Time    // current fake time
+	timers []*fakeTimer // armed timers, dropped once they fire or are stopped
+}
+
+// NewFakeClock creates a FakeClock starting at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer creates a timer that fires once the fake time has advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) key_wrapper.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.arm(d)
+
+	return t
+}
+
+// Advance moves the fake time forward by d and fires all timers whose
+// deadline has been reached, in deadline order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	c.fireDue()
+}
+
+// ActiveTimers returns the number of timers that are armed and have not fired yet.
+func (c *FakeClock) ActiveTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.activeTimers()
+}
+
+// BlockUntil blocks until at least n timers are armed. It lets a test wait
+// until the code under test has scheduled its next event before advancing.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.activeTimers() < n {
+		c.cond.Wait()
+	}
+}
+
+// activeTimers counts the armed timers. The caller must hold c.mu.
+func (c *FakeClock) activeTimers() int {
+	return len(c.timers)
+}
+
+// removeTimer drops a stopped timer from the armed timers.
+// The caller must hold c.mu.
+func (c *FakeClock) removeTimer(t *fakeTimer) {
+	for i, armed := range c.timers {
+		if armed == t {
+			last := len(c.timers) - 1
+			copy(c.timers[i:], c.timers[i+1:])
+			c.timers[last] = nil
+			c.timers = c.timers[:last]
+
+			return
+		}
+	}
+}
+
+// fireDue fires the armed timers whose deadline has been reached
+// and drops them from the armed timers. The caller must hold c.mu.
+func (c *FakeClock) fireDue() {
+	var due []*fakeTimer
+
+	armed := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			armed = append(armed, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+
+	// clear the tail so fired timers are not kept alive
+	for i := len(armed); i < len(c.timers); i++ {
+		c.timers[i] = nil
+	}
+
+	c.timers = armed
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].deadline.Before(due[j].deadline)
+	})
+
+	for _, t := range due {
+		t.active = false
+
+		// like time.Timer, a fired value that was not received yet is kept
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+	}
+
+	if len(due) > 0 {
+		c.cond.Broadcast()
+	}
+}
+
+// fakeTimer is a key_wrapper.Timer of a FakeClock.
+type fakeTimer struct {
+	clock    *FakeClock
+	ch       chan time.Time
+	deadline time.Time // when the timer fires, valid while active
+	active   bool      // armed and not fired or stopped yet
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.active
+	if wasActive {
+		t.active = false
+		t.clock.removeTimer(t)
+	}
+
+	t.clock.cond.Broadcast()
+
+	return wasActive
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.active
+	t.arm(d)
+
+	return wasActive
+}
+
+// arm schedules the timer to fire after d. The caller must hold t.clock.mu.
+func (t *fakeTimer) arm(d time.Duration) {
+	t.deadline = t.clock.now.Add(d)
+
+	if !t.active {
+		t.active = true
+		t.clock.timers = append(t.clock.timers, t)
+	}
+
+	t.clock.cond.Broadcast()
+
+	t.clock.fireDue()
+}
@@ -0,0 +1,122 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	t.Run("timers fire on advance", func(t *testing.T) {
+		c := NewFakeClock(start)
+		timer := c.NewTimer(time.Second)
+
+		c.Advance(999 * time.Millisecond)
+
+		select {
+		case <-timer.C():
+			t.Fatal("timer fired too early")
+		default:
+		}
+
+		c.Advance(time.Millisecond)
+
+		select {
+		case got := <-timer.C():
+			if exp := start.Add(time.Second); !got.Equal(exp) {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		default:
+			t.Fatal("timer did not fire")
+		}
+
+		if got := c.ActiveTimers(); got != 0 {
+			t.Fatalf("got=%d active timers, exp=0", got)
+		}
+	})
+
+	t.Run("stop and reset", func(t *testing.T) {
+		c := NewFakeClock(start)
+		timer := c.NewTimer(time.Second)
+
+		if !timer.Stop() {
+			t.Fatal("expected active timer")
+		}
+
+		c.Advance(time.Second)
+
+		select {
+		case <-timer.C():
+			t.Fatal("stopped timer fired")
+		default:
+		}
+
+		if timer.Reset(time.Second) {
+			t.Fatal("expected inactive timer")
+		}
+
+		c.Advance(time.Second)
+
+		select {
+		case <-timer.C():
+		default:
+			t.Fatal("timer did not fire")
+		}
+
+		if got, exp := c.Now(), start.Add(2*time.Second); !got.Equal(exp) {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	})
+
+	t.Run("block until timers are armed", func(t *testing.T) {
+		c := NewFakeClock(start)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.BlockUntil(2)
+		}()
+
+		c.NewTimer(time.Second)
+		c.NewTimer(time.Minute)
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("BlockUntil did not return")
+		}
+	})
+
+	t.Run("inactive timers are dropped", func(t *testing.T) {
+		c := NewFakeClock(start)
+
+		for i := 0; i < 100; i++ {
+			c.NewTimer(time.Second).Stop()
+			c.NewTimer(time.Second)
+		}
+
+		c.Advance(time.Second)
+
+		if got := len(c.timers); got != 0 {
+			t.Fatalf("got=%d timers kept, exp=0", got)
+		}
+
+		timer := c.NewTimer(time.Second)
+		timer.Reset(2 * time.Second)
+
+		if got := len(c.timers); got != 1 {
+			t.Fatalf("got=%d timers after reset, exp=1", got)
+		}
+	})
+
+	t.Run("zero duration fires immediately", func(t *testing.T) {
+		c := NewFakeClock(start)
+
+		select {
+		case <-c.NewTimer(0).C():
+		default:
+			t.Fatal("timer did not fire")
+		}
+	})
+}
@@ -11,12 +11,67 @@ import (
 type Config struct {
 	// GetShardsCount is a function that returns the current number of shards.
 	// It should return an error if the shard count cannot be determined.
+	// It cannot be canceled; use ShardsCountSource for sources that may hang.
 	GetShardsCount func() (int, error)
+	// ShardsCountSource provides the current number of shards like GetShardsCount,
+	// but receives a context that is canceled on Stop and bounded by SourceTimeout.
+	// Only one of GetShardsCount and ShardsCountSource may be set.
+	ShardsCountSource ShardsCountSource
+	// GetShardIDs is a function that returns the identifiers of the current shards.
+	// It is used by named wrappers and can be set instead of or
+	// in addition to GetShardsCount.
+	GetShardIDs func() ([]string, error)
+	// GetShardWeights is a function that returns the current weight of every shard,
+	// where the i-th weight belongs to the shard with postfix ":i+1".
+	// It is used by weighted wrappers.
+	GetShardWeights func() ([]int, error)
+	// GetSlotTable is a function that returns the current slot-to-shard table,
+	// where the i-th entry is the shard number owning logical slot i.
+	// It is used by slot wrappers.
+	GetSlotTable func() ([]int, error)
+	// GetSlotMigrations is a function that returns the slots currently moving
+	// between shards and their migration state. Slots that are no longer
+	// returned complete or abort their migration.
+	// It is used by slot wrappers.
+	GetSlotMigrations func() ([]SlotMigration, error)
+	// GetClusterSlots is a function that returns the Redis Cluster slot ranges
+	// served by every master node, e.g. from CLUSTER SHARDS or CLUSTER SLOTS.
+	// It is used by Redis Cluster wrappers.
+	GetClusterSlots func() ([]ClusterSlotRange, error)
 	// Factory is the factory instance that will be updated with new shard counts.
 	Factory *Factory
 	// Interval specifies how often the interrogator
 	// should check for shard count changes.
 	Interval time.Duration
+	// PollOnStart makes the first check run right after the interrogator
+	// starts instead of after the first Interval, so a wrong initial shard
+	// count of the Factory is corrected immediately.
+	PollOnStart bool
+	// IntervalJitter spreads the delay between checks uniformly by up to this
+	// fraction of Interval in both directions, e.g. 0.1 gives 0.9-1.1 * Interval,
+	// so that many instances do not poll the source in lockstep.
+	// It must be between 0 and 1; 0 disables the jitter.
+	IntervalJitter float64
+	// MaxBackoff enables exponential backoff with full jitter when greater than zero.
+	// After n consecutive checks with a failing source function, the next check
+	// happens after a random delay between zero and Interval * 2^n, capped at
+	// MaxBackoff. A successful check resets the backoff.
+	// It must not be less than Interval.
+	MaxBackoff time.Duration
+	// CommitDelay enables two-phase shard count changes when greater than zero.
+	// A new shard count is first prepared, so read-side APIs already cover it
+	// while wrappers keep the old count, and is committed to the wrappers after
+	// CommitDelay, unless Factory.CommitPending is called earlier.
+	CommitDelay time.Duration
+	// SourceTimeout bounds every call of ShardsCountSource when greater than zero.
+	// A call that does not return in time fails like any other source error.
+	SourceTimeout time.Duration
+
+	// Clock provides the timers of the Interrogator.
+	// It defaults to the clock of the Factory (see WithClock), which is the
+	// real clock unless set; tests can use a fake clock from the clocktest
+	// package to control time step by step.
+	Clock Clock
 
 	// ErrorHandler is a required function used to handle errors
 	// encountered during shard count retrieval.
@@ -24,8 +79,12 @@ type Config struct {
 }
 
 func (cfg *Config) Validate() error {
-	if cfg.GetShardsCount == nil {
-		return errors.New("GetShardsCount function is required")
+	if !cfg.hasSource() {
+		return errors.New("GetShardsCount or another source function is required")
+	}
+
+	if cfg.GetShardsCount != nil && cfg.ShardsCountSource != nil {
+		return errors.New("only one of GetShardsCount and ShardsCountSource may be set")
 	}
 
 	if cfg.Factory == nil {
@@ -36,9 +95,67 @@ func (cfg *Config) Validate() error {
 		return errors.New("Interval must be greater than zero")
 	}
 
+	if cfg.IntervalJitter < 0 || cfg.IntervalJitter > 1 {
+		return errors.New("IntervalJitter must be between 0 and 1")
+	}
+
+	if cfg.MaxBackoff < 0 {
+		return errors.New("MaxBackoff must not be negative")
+	}
+
+	if cfg.MaxBackoff > 0 && cfg.MaxBackoff < cfg.Interval {
+		return errors.New("MaxBackoff must not be less than Interval")
+	}
+
+	if cfg.CommitDelay < 0 {
+		return errors.New("CommitDelay must not be negative")
+	}
+
+	if cfg.SourceTimeout < 0 {
+		return errors.New("SourceTimeout must not be negative")
+	}
+
 	if cfg.ErrorHandler == nil {
 		return errors.New("ErrorHandler function is required")
 	}
 
 	return nil
 }
+
+// hasSource reports whether at least one source function is configured.
+func (cfg *Config) hasSource() bool {
+	return cfg.GetShardsCount != nil ||
+		cfg.ShardsCountSource != nil ||
+		cfg.GetShardIDs != nil ||
+		cfg.GetShardWeights != nil ||
+		cfg.GetSlotTable != nil ||
+		cfg.GetSlotMigrations != nil ||
+		cfg.GetClusterSlots != nil
+}
+
+// clock returns the configured clock, the clock of the factory or the real one.
+func (cfg *Config) clock() Clock {
+	if cfg.Clock != nil {
+		return cfg.Clock
+	}
+
+	if cfg.Factory != nil && cfg.Factory.clock != nil {
+		return cfg.Factory.clock
+	}
+
+	return realClock{}
+}
+
+// shardsCountSource returns the configured shard count source, adapting
+// GetShardsCount if needed, or nil if neither is set.
+func (cfg *Config) shardsCountSource() ShardsCountSource {
+	if cfg.ShardsCountSource != nil {
+		return cfg.ShardsCountSource
+	}
+
+	if cfg.GetShardsCount != nil {
+		return ShardsCountFunc(cfg.GetShardsCount)
+	}
+
+	return nil
+}
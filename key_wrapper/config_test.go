@@ -1,6 +1,7 @@
 package key_wrapper
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -32,7 +33,83 @@ func TestConfig_Validate(t *testing.T) {
 			t.Fatal("expected error, got nil")
 		}
 
-		expected := "GetShardsCount function is required"
+		expected := "GetShardsCount or another source function is required"
+		if err.Error() != expected {
+			t.Fatalf("expected error %q, got %q", expected, err.Error())
+		}
+	})
+
+	t.Run("only GetShardIDs", func(t *testing.T) {
+		cfg := &Config{
+			GetShardIDs:  func() ([]string, error) { return []string{"a"}, nil },
+			Factory:      &Factory{},
+			Interval:     time.Second,
+			ErrorHandler: func(err error) {},
+		}
+
+		err := cfg.Validate()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("only GetShardWeights", func(t *testing.T) {
+		cfg := &Config{
+			GetShardWeights: func() ([]int, error) { return []int{1}, nil },
+			Factory:         &Factory{},
+			Interval:        time.Second,
+			ErrorHandler:    func(err error) {},
+		}
+
+		err := cfg.Validate()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("only GetSlotTable", func(t *testing.T) {
+		cfg := &Config{
+			GetSlotTable: func() ([]int, error) { return []int{1}, nil },
+			Factory:      &Factory{},
+			Interval:     time.Second,
+			ErrorHandler: func(err error) {},
+		}
+
+		err := cfg.Validate()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("only ShardsCountSource", func(t *testing.T) {
+		cfg := &Config{
+			ShardsCountSource: ShardsCountSourceFunc(func(ctx context.Context) (int, error) { return 1, nil }),
+			Factory:           &Factory{},
+			Interval:          time.Second,
+			ErrorHandler:      func(err error) {},
+		}
+
+		err := cfg.Validate()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("GetShardsCount and ShardsCountSource", func(t *testing.T) {
+		cfg := &Config{
+			GetShardsCount:    func() (int, error) { return 1, nil },
+			ShardsCountSource: ShardsCountFunc(func() (int, error) { return 1, nil }),
+			Factory:           &Factory{},
+			Interval:          time.Second,
+			ErrorHandler:      func(err error) {},
+		}
+
+		err := cfg.Validate()
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		expected := "only one of GetShardsCount and ShardsCountSource may be set"
 		if err.Error() != expected {
 			t.Fatalf("expected error %q, got %q", expected, err.Error())
 		}
@@ -94,6 +171,62 @@ func TestConfig_Validate(t *testing.T) {
 		}
 	})
 
+	t.Run("negative commit delay", func(t *testing.T) {
+		cfg := &Config{
+			GetShardsCount: func() (int, error) { return 1, nil },
+			Factory:        &Factory{},
+			Interval:       time.Second,
+			CommitDelay:    -time.Second,
+			ErrorHandler:   func(err error) {},
+		}
+
+		err := cfg.Validate()
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		expected := "CommitDelay must not be negative"
+		if err.Error() != expected {
+			t.Fatalf("expected error %q, got %q", expected, err.Error())
+		}
+	})
+
+	t.Run("invalid backoff and jitter", func(t *testing.T) {
+		invalid := map[string]func(cfg *Config){
+			"IntervalJitter must be between 0 and 1": func(cfg *Config) {
+				cfg.IntervalJitter = 1.5
+			},
+			"MaxBackoff must not be negative": func(cfg *Config) {
+				cfg.MaxBackoff = -time.Second
+			},
+			"MaxBackoff must not be less than Interval": func(cfg *Config) {
+				cfg.MaxBackoff = time.Millisecond
+			},
+			"SourceTimeout must not be negative": func(cfg *Config) {
+				cfg.SourceTimeout = -time.Second
+			},
+		}
+
+		for expected, modify := range invalid {
+			cfg := &Config{
+				GetShardsCount: func() (int, error) { return 1, nil },
+				Factory:        &Factory{},
+				Interval:       time.Second,
+				ErrorHandler:   func(err error) {},
+			}
+			modify(cfg)
+
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+
+			if err.Error() != expected {
+				t.Fatalf("expected error %q, got %q", expected, err.Error())
+			}
+		}
+	})
+
 	t.Run("missing ErrorHandler", func(t *testing.T) {
 		cfg := &Config{
 			GetShardsCount: func() (int, error) { return 1, nil },
@@ -0,0 +1,65 @@
+package key_wrapper
+
+import (
+	"context"
+)
+
+// ContextKeyWrapper is a KeyWrapper that can pin its shard choice into
+// a context.Context. All keys wrapped with WrapKeyContext within a pinned
+// context share one postfix, so related keys of one request (MULTI/EXEC,
+// Lua scripts) land on the same shard.
+//
+// The wrappers returned by MakeKeyWrapper, MakeOnlyGrowingKeyWrapper and
+// MakeWeightedKeyWrapper implement ContextKeyWrapper:
+//
+//	cw := factory.MakeKeyWrapper().(key_wrapper.ContextKeyWrapper)
+//	ctx = cw.PinShard(ctx)
+//	cw.WrapKeyContext(ctx, "order:1") // "order:1:3"
+//	cw.WrapKeyContext(ctx, "items:1") // "items:1:3"
+type ContextKeyWrapper interface {
+	KeyWrapper
+	// PinShard picks the next shard in the wrapper's rotation and returns
+	// a copy of ctx carrying that choice. The rotation advances once per pin,
+	// no matter how many keys are wrapped within the returned context.
+	PinShard(ctx context.Context) context.Context
+	// WrapKeyContext wraps the key with the shard pinned into ctx by PinShard
+	// of the same wrapper. Without a pin it behaves like WrapKey.
+	// If the shard count went below the pinned shard, the pin is mapped
+	// onto the current shards, the same for every key of the context.
+	WrapKeyContext(ctx context.Context, key string) string
+}
+
+// Compile-time interface compliance checks
+var _ ContextKeyWrapper = (*keyWrapper)(nil)
+var _ ContextKeyWrapper = (*weightedKeyWrapper)(nil)
+
+// shardPinKey is the context key of a shard pinned by a wrapper.
+// Pins are keyed by the wrapper, so pins of different wrappers
+// in the same context do not affect each other.
+type shardPinKey struct {
+	wrapper KeyWrapper
+}
+
+// withPinnedShard returns a copy of ctx with the shard pinned for the wrapper.
+func withPinnedShard(ctx context.Context, wrapper KeyWrapper, shard int) context.Context {
+	return context.WithValue(ctx, shardPinKey{wrapper: wrapper}, shard)
+}
+
+// pinnedShard returns the shard pinned into ctx for the wrapper
+// and reports whether there is one.
+func pinnedShard(ctx context.Context, wrapper KeyWrapper) (int, bool) {
+	shard, ok := ctx.Value(shardPinKey{wrapper: wrapper}).(int)
+
+	return shard, ok
+}
+
+// pinWithin maps a pinned shard onto count shards. A pin above a decreased
+// shard count would write to a shard readers no longer cover, so it wraps
+// around deterministically and all keys of the context still land together.
+func pinWithin(shard, count int) int {
+	if count < 1 {
+		return 1
+	}
+
+	return (shard-1)%count + 1
+}
@@ -0,0 +1,159 @@
+package key_wrapper
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContextKeyWrapper_PinShard(t *testing.T) {
+	t.Run("keys of a pin share one postfix", func(t *testing.T) {
+		kw := newKeyWrapper(3, Formatter{})
+
+		ctx := kw.PinShard(context.Background())
+
+		for _, key := range []string{"order:1", "items:1", "total:1"} {
+			if got, exp := kw.WrapKeyContext(ctx, key), key+":1"; got != exp {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		}
+
+		// the rotation advanced once for the pin
+		if got := kw.WrapKey("key"); got != "key:2" {
+			t.Fatalf("got=%s, exp=key:2", got)
+		}
+
+		ctx = kw.PinShard(context.Background())
+		if got := kw.WrapKeyContext(ctx, "key"); got != "key:3" {
+			t.Fatalf("got=%s, exp=key:3", got)
+		}
+	})
+
+	t.Run("without a pin the rotation continues", func(t *testing.T) {
+		kw := newKeyWrapper(2, Formatter{})
+
+		ctx := context.Background()
+		for _, exp := range []string{"key:1", "key:2", "key:1"} {
+			if got := kw.WrapKeyContext(ctx, "key"); got != exp {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		}
+	})
+
+	t.Run("pins are kept per wrapper", func(t *testing.T) {
+		a := newKeyWrapper(4, Formatter{})
+		b := newWeightedKeyWrapper([]int{1, 1, 1, 1}, Formatter{})
+
+		a.WrapKey("skip")
+
+		ctx := a.PinShard(context.Background())
+		ctx = b.PinShard(ctx)
+
+		if got := a.WrapKeyContext(ctx, "key"); got != "key:2" {
+			t.Fatalf("got=%s, exp=key:2", got)
+		}
+
+		if got := b.WrapKeyContext(ctx, "key"); got != "key:1" {
+			t.Fatalf("got=%s, exp=key:1", got)
+		}
+
+		// another wrapper without a pin in ctx keeps rotating
+		c := newKeyWrapper(4, Formatter{})
+		c.WrapKey("skip")
+
+		if got := c.WrapKeyContext(ctx, "key"); got != "key:2" {
+			t.Fatalf("got=%s, exp=key:2", got)
+		}
+	})
+
+	t.Run("pin survives shard count increases", func(t *testing.T) {
+		kw := newKeyWrapper(4, Formatter{})
+		kw.WrapKey("skip")
+		kw.WrapKey("skip")
+
+		ctx := kw.PinShard(context.Background())
+		kw.ResetShardsCount(6)
+
+		if got := kw.WrapKeyContext(ctx, "key"); got != "key:3" {
+			t.Fatalf("got=%s, exp=key:3", got)
+		}
+	})
+
+	t.Run("pin is mapped onto a decreased shard count", func(t *testing.T) {
+		kw := newKeyWrapper(4, Formatter{})
+		kw.WrapKey("skip")
+		kw.WrapKey("skip")
+		kw.WrapKey("skip")
+
+		ctx := kw.PinShard(context.Background())
+		kw.ResetShardsCount(2)
+
+		// shard 4 is no longer read, so the pin moves to shard 2 for all keys
+		for _, key := range []string{"a", "b"} {
+			if got, exp := kw.WrapKeyContext(ctx, key), key+":2"; got != exp {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		}
+	})
+}
+
+func TestFactory_ContextKeyWrapper(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	wrappers := map[string]KeyWrapper{
+		"general":  f.MakeKeyWrapper(),
+		"growing":  f.MakeOnlyGrowingKeyWrapper(),
+		"weighted": f.MakeWeightedKeyWrapper(),
+	}
+
+	for name, w := range wrappers {
+		cw, ok := w.(ContextKeyWrapper)
+		if !ok {
+			t.Fatalf("%s wrapper does not implement ContextKeyWrapper", name)
+		}
+
+		ctx := cw.PinShard(context.Background())
+		if got, exp := cw.WrapKeyContext(ctx, "a"), cw.WrapKeyContext(ctx, "b"); got[1:] != exp[1:] {
+			t.Fatalf("%s: got=%s, exp=%s", name, got, exp)
+		}
+	}
+}
+
+func TestFactory_PinnedShardAfterShrink(t *testing.T) {
+	f, err := NewFactory(4)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	wrappers := map[string]ContextKeyWrapper{
+		"general":  f.MakeKeyWrapper().(ContextKeyWrapper),
+		"weighted": f.MakeWeightedKeyWrapper().(ContextKeyWrapper),
+	}
+
+	pins := make(map[string]context.Context)
+	for name, cw := range wrappers {
+		var ctx context.Context
+		for i := 0; i < 4; i++ {
+			ctx = cw.PinShard(context.Background()) // the last pin is shard 4
+		}
+
+		pins[name] = ctx
+	}
+
+	if err := f.compareAndUpdate(2); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+
+	readable := make(map[string]bool)
+	for _, key := range f.AllKeys("k") {
+		readable[key] = true
+	}
+
+	for name, cw := range wrappers {
+		if got := cw.WrapKeyContext(pins[name], "k"); !readable[got] {
+			t.Fatalf("%s: %s is not covered by AllKeys %v", name, got, f.AllKeys("k"))
+		}
+	}
+}
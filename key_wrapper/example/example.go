@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/releaseband/wrappers/v2/key_wrapper"
+	"github.com/releaseband/wrappers/v2/key_wrapper/clocktest"
 )
 
 // Example demonstrates basic usage of the key_wrapper library
@@ -67,11 +68,15 @@ func ExampleUpdateShards() {
 		return updatedShards, nil
 	}
 
-	// Configure interrogator with short interval for demo
+	// A fake clock lets the demo move time forward without sleeping
+	clock := clocktest.NewFakeClock(time.Now())
+
+	// Configure interrogator
 	config := &key_wrapper.Config{
 		GetShardsCount: getCurrentShards,
 		Factory:        factory,
-		Interval:       100 * time.Millisecond, // Check every 100ms for demo
+		Interval:       30 * time.Second,
+		Clock:          clock,
 		ErrorHandler: func(err error) {
 			panic("error in interrogator: " + err.Error())
 		},
@@ -102,7 +107,7 @@ func ExampleUpdateShards() {
 
 	for i, exp := range outputs {
 		if i == 3 {
-			time.Sleep(300 * time.Millisecond)
+			advanceChecks(clock, config.Interval, 3)
 			fmt.Println("After interrogator detects change from 2 to 4 shards")
 		}
 
@@ -143,11 +148,15 @@ func ExampleOnlyGrowKeyWrapper() {
 		return updatedShards, nil
 	}
 
-	// Configure interrogator with short interval for demo
+	// A fake clock lets the demo move time forward without sleeping
+	clock := clocktest.NewFakeClock(time.Now())
+
+	// Configure interrogator
 	config := &key_wrapper.Config{
 		GetShardsCount: getCurrentShards,
 		Factory:        factory,
-		Interval:       100 * time.Millisecond, // Check every 100ms for demo
+		Interval:       30 * time.Second,
+		Clock:          clock,
 		ErrorHandler: func(err error) {
 			panic("error in interrogator: " + err.Error())
 		},
@@ -182,7 +191,7 @@ func ExampleOnlyGrowKeyWrapper() {
 
 	for i, exp := range outputs {
 		if i == 3 {
-			time.Sleep(300 * time.Millisecond)
+			advanceChecks(clock, config.Interval, 3)
 			fmt.Println("After interrogator detects change from 4 to 2 shards:")
 		}
 
@@ -195,3 +204,15 @@ func ExampleOnlyGrowKeyWrapper() {
 		fmt.Printf("%s -> %s \n", key, got)
 	}
 }
+
+// advanceChecks lets the interrogator run n checks: it waits until the next
+// check is scheduled, then moves the fake clock past it.
+func advanceChecks(clock *clocktest.FakeClock, interval time.Duration, n int) {
+	for i := 0; i < n; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(interval)
+	}
+
+	// the last check is done once the next one is scheduled
+	clock.BlockUntil(1)
+}
@@ -1,29 +1,107 @@
 package key_wrapper
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // Factory creates and manages KeyWrapper instances.
 // It maintains two types of wrappers: general wrappers that update on any shard count change,
 // and only-growing wrappers that only update when shard count increases.
+// Named wrappers distribute keys over a list of shard identifiers instead of a count,
+// weighted wrappers distribute keys proportionally to per-shard weights,
+// slot wrappers map keys to logical slots owned by shards through a slot table,
+// and Redis Cluster wrappers spread keys over the masters of a Redis Cluster.
 // Factory ensures thread-safe operations and shard count management.
 //
+// Every wrapper stays registered until it is closed with its Close method
+// (all wrappers implement io.Closer) or Factory.Release, or until it becomes
+// unreachable, so short-lived wrappers do not pile up in the factory.
+//
 // All public methods are thread-safe and can be called concurrently.
 type Factory struct {
-	mu                  *sync.RWMutex // protects all fields from concurrent access
-	generalWrappers     *store        // wrappers that update on any shard count change
-	onlyGrowingWrappers *store        // wrappers that only update on shard count increases
-	shardsCount         int           // current number of shards for key distribution
+	mu                   *sync.RWMutex         // protects all fields from concurrent access
+	generalWrappers      *store                // wrappers that update on any shard count change
+	onlyGrowingWrappers  *store                // wrappers that only update on shard count increases
+	namedWrappers        *store                // wrappers that update on shard ID changes
+	weightedWrappers     *store                // wrappers that update on shard weight changes
+	slotWrappers         *store                // wrappers that update on slot table changes
+	clusterWrappers      *store                // wrappers that update on Redis Cluster slot map changes
+	shardsCount          int                   // current number of shards for key distribution
+	shards               *shardSnapshot        // snapshot of shardsCount shared by round-robin and hash wrappers
+	pendingShardsCount   int                   // prepared but not committed shard count, or noPendingShardsCount
+	highWaterShardsCount int                   // highest shard count ever applied
+	highWaterStore       HighWaterStore        // optional persistence of highWaterShardsCount
+	highWaterSaveMu      *sync.Mutex           // serializes saves to highWaterStore, guards savedHighWater
+	savedHighWater       int                   // highest shard count persisted in highWaterStore
+	shardIDs             []string              // sorted shard identifiers, nil until first set
+	shardWeights         []int                 // per-shard weights, nil until first set
+	slotsCount           int                   // number of logical slots used by slot wrappers
+	slotTable            []int                 // shard number of every slot, nil until first set
+	slotOverrides        map[int]int           // owners of slots moved by migrations while no table is set
+	slotChanges          []SlotChange          // slots that changed owner on the last table change
+	slotMigrations       map[int]SlotMigration // in-flight slot migrations keyed by slot
+	clusterSlots         []ClusterSlotRange    // Redis Cluster slot ranges sorted by start, nil until first set
+	clusterTagger        *clusterTagger        // tag search over clusterSlots shared by Redis Cluster wrappers
+	clusterTagMisses     *int64                // Redis Cluster tag searches without a match, updated atomically
+	counterStripes       int                   // counter stripes of round-robin wrappers, 0 for a single counter
+	subscriptions        []*subscription       // subscribers of shard count changes
+	droppedShardEvents   int                   // shard change events dropped for slow subscribers
+	slotSubscriptions    []*subscription       // subscribers of slot table changes
+	droppedSlotEvents    int                   // slot change events dropped for slow subscribers
+	shardChangeHooks     []*shardChangeHook    // hooks that can reject shard count changes
+	rejectedShardChanges int                   // shard count changes rejected by hooks
+	format               Formatter             // renders shard postfixes of all wrappers
+	clock                Clock                 // time source of change events
+}
+
+// FactoryOption configures optional Factory settings in NewFactory.
+type FactoryOption func(f *Factory) error
+
+// WithSlotsCount sets the number of logical slots keys are hashed into
+// by slot wrappers. The default is 1024 slots.
+func WithSlotsCount(count int) FactoryOption {
+	return func(f *Factory) error {
+		if count < 1 || count > maxSlotsCount {
+			return fmt.Errorf("slots count must be between 1 and %d, got %d",
+				maxSlotsCount, count)
+		}
+
+		f.slotsCount = count
+
+		return nil
+	}
 }
 
 // FactoryStats provides statistical information about a Factory instance.
 // All values represent the current state at the time of the Stats() call.
+// Wrapper counts only include wrappers that have not been released.
 type FactoryStats struct {
-	Shards          int // current number of shards configured
-	GeneralWrappers int // number of registered general wrappers
-	GrowingWrappers int // number of registered growing-only wrappers
+	Shards               int // current number of shards configured
+	PendingShards        int // shard count waiting to be committed, or 0 if none
+	HighWaterShards      int // highest shard count ever applied, including persisted marks
+	GeneralWrappers      int // number of registered general wrappers
+	GrowingWrappers      int // number of registered growing-only wrappers
+	NamedWrappers        int // number of registered named wrappers
+	WeightedWrappers     int // number of registered weighted wrappers
+	SlotWrappers         int // number of registered slot wrappers
+	ClusterWrappers      int // number of registered Redis Cluster wrappers
+	Slots                int // number of logical slots used by slot wrappers
+	MigratingSlots       int // number of slots in the migrating state
+	ImportingSlots       int // number of slots in the importing state
+	ClusterNodes         int // number of Redis Cluster masters in the slot map
+	ClusterTagMisses     int // Redis Cluster keys wrapped for a master that does not serve their slot
+	Subscribers          int // number of shard change subscribers
+	DroppedShardEvents   int // shard change events dropped because a subscriber was too slow
+	SlotSubscribers      int // number of slot change subscribers
+	DroppedSlotEvents    int // slot change events dropped because a subscriber was too slow
+	RejectedShardChanges int // shard count changes rejected by shard change hooks
+
+	ShardIDs []string // shard identifiers used by named wrappers
+	Weights  []int    // active shard weights used by weighted wrappers
 }
 
 const (
@@ -33,24 +111,171 @@ const (
 	// maxShardsCount defines the maximum allowed number of shards.
 	// This limit prevents excessive memory usage and ensures reasonable performance.
 	maxShardsCount = 10_000
+	// noPendingShardsCount marks that no two-phase shard count change is pending.
+	noPendingShardsCount = -1
+	// maxCounterStripes limits the counter stripes of a round-robin wrapper.
+	maxCounterStripes = 1024
 )
 
+// WithHighWaterStore makes the factory persist the highest shard count it has
+// ever applied in store. NewFactory loads the stored mark back, so readers
+// using AllOnlyGrowingKeys keep covering high shards after a restart
+// with a lower shard count.
+func WithHighWaterStore(store HighWaterStore) FactoryOption {
+	return func(f *Factory) error {
+		if store == nil {
+			return errors.New("high-water store must not be nil")
+		}
+
+		f.highWaterStore = store
+
+		return nil
+	}
+}
+
+// WithFormatter sets the format of the shard postfixes of all wrappers
+// created by the factory, e.g. a custom delimiter, zero padding,
+// zero-based or base36 shard IDs, or prefix placement.
+func WithFormatter(format Formatter) FactoryOption {
+	return func(f *Factory) error {
+		if err := format.Validate(); err != nil {
+			return err
+		}
+
+		f.format = format
+
+		return nil
+	}
+}
+
+// WithStripedCounters makes the round-robin wrappers created by MakeKeyWrapper
+// and MakeOnlyGrowingKeyWrapper rotate with the given number of padded counter
+// stripes instead of a single shared counter. Concurrent callers on different
+// processors then use different stripes, which removes the cache-line hotspot
+// of a global wrapper at the cost of an approximate rotation: the shard counts
+// differ by at most the number of stripes. runtime.GOMAXPROCS(0) is a good choice.
+func WithStripedCounters(stripes int) FactoryOption {
+	return func(f *Factory) error {
+		if stripes < 1 || stripes > maxCounterStripes {
+			return fmt.Errorf("counter stripes must be between 1 and %d, got %d",
+				maxCounterStripes, stripes)
+		}
+
+		f.counterStripes = stripes
+
+		return nil
+	}
+}
+
+// WithClock sets the clock the factory reads the time of change events from.
+// An Interrogator without its own Config.Clock uses it as well, so a test can
+// set a fake clock from the clocktest package once for both.
+func WithClock(clock Clock) FactoryOption {
+	return func(f *Factory) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+
+		f.clock = clock
+
+		return nil
+	}
+}
+
 // NewFactory creates a new Factory with the specified initial shard count.
 // The shard count determines how many different postfixes will be used
 // when wrapping keys (e.g., ":1", ":2", ":3" for shardsCount=3).
 // An error is returned if the initial shard count is
-// less than 0 or greater than 10_000
-func NewFactory(initialShardsCount int) (*Factory, error) {
+// less than 0 or greater than 10_000, or if any of the options is invalid.
+func NewFactory(initialShardsCount int, opts ...FactoryOption) (*Factory, error) {
 	if err := validateShardsCount(initialShardsCount); err != nil {
 		return nil, err
 	}
 
-	return &Factory{
-		mu:                  &sync.RWMutex{},
-		onlyGrowingWrappers: newStore(),
-		generalWrappers:     newStore(),
-		shardsCount:         initialShardsCount,
-	}, nil
+	f := &Factory{
+		mu:                   &sync.RWMutex{},
+		onlyGrowingWrappers:  newStore(applySnapshot),
+		generalWrappers:      newStore(applySnapshot),
+		namedWrappers:        newStore(applyShardIDs),
+		weightedWrappers:     newStore(applyShardWeights),
+		slotWrappers:         newStore(applySlots),
+		clusterWrappers:      newStore(applyTagger),
+		shardsCount:          initialShardsCount,
+		pendingShardsCount:   noPendingShardsCount,
+		highWaterShardsCount: initialShardsCount,
+		highWaterSaveMu:      &sync.Mutex{},
+		slotsCount:           defaultSlotsCount,
+		clusterTagMisses:     new(int64),
+		clock:                realClock{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f.shards = newShardSnapshot(f.shardsCount, f.format)
+	f.clusterTagger = newClusterTagger(nil, f.format)
+
+	if f.highWaterStore != nil {
+		if err := f.loadHighWater(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// loadHighWater restores the high-water mark from the high-water store
+// and stores the initial shard count if it is higher than the stored mark.
+func (f *Factory) loadHighWater() error {
+	stored, err := f.highWaterStore.Load()
+	if err != nil {
+		return fmt.Errorf("load high-water mark: %w", err)
+	}
+
+	if stored > maxShardsCount {
+		return fmt.Errorf("stored high-water mark must be less than %d, got %d",
+			maxShardsCount, stored)
+	}
+
+	f.savedHighWater = stored
+
+	if stored >= f.highWaterShardsCount {
+		f.highWaterShardsCount = stored
+		return nil
+	}
+
+	return f.saveHighWater()
+}
+
+// saveHighWater persists the high-water mark if it is above the last persisted
+// one, so a failed save is retried by the next call. It is called after every
+// shard count update without f.mu held, so disk I/O does not block the factory.
+func (f *Factory) saveHighWater() error {
+	if f.highWaterStore == nil {
+		return nil
+	}
+
+	f.highWaterSaveMu.Lock()
+	defer f.highWaterSaveMu.Unlock()
+
+	f.mu.RLock()
+	mark := f.highWaterShardsCount
+	f.mu.RUnlock()
+
+	if mark <= f.savedHighWater {
+		return nil
+	}
+
+	if err := f.highWaterStore.Save(mark); err != nil {
+		return fmt.Errorf("save high-water mark: %w", err)
+	}
+
+	f.savedHighWater = mark
+
+	return nil
 }
 
 // validateShardsCount checks if the provided shard count is within acceptable limits.
@@ -69,6 +294,84 @@ func validateShardsCount(count int) error {
 	return nil
 }
 
+// validateShardIDs checks if the provided shard identifiers can be used
+// for key distribution: the list must be non-empty, within the shard limit,
+// and contain only unique, non-empty identifiers.
+func validateShardIDs(ids []string) error {
+	if len(ids) == 0 {
+		return errors.New("shard IDs must not be empty")
+	}
+
+	if len(ids) > maxShardsCount {
+		return fmt.Errorf("shard IDs count must be less than %d, got %d",
+			maxShardsCount, len(ids))
+	}
+
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return errors.New("shard ID must not be empty")
+		}
+
+		if _, ok := seen[id]; ok {
+			return fmt.Errorf("duplicate shard ID %q", id)
+		}
+
+		seen[id] = struct{}{}
+	}
+
+	return nil
+}
+
+// validateShardWeights checks if the provided shard weights can be used
+// for key distribution: the list must be non-empty, within the shard limit,
+// contain no negative weights and have a positive sum.
+func validateShardWeights(weights []int) error {
+	if len(weights) == 0 {
+		return errors.New("shard weights must not be empty")
+	}
+
+	if len(weights) > maxShardsCount {
+		return fmt.Errorf("shard weights count must be less than %d, got %d",
+			maxShardsCount, len(weights))
+	}
+
+	var total int
+	for i, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("shard %d weight must not be negative, got %d",
+				i+1, weight)
+		}
+
+		total += weight
+	}
+
+	if total == 0 {
+		return errors.New("at least one shard weight must be positive")
+	}
+
+	return nil
+}
+
+// validateSlotTable checks if the provided slot table can be used with
+// slotsCount slots: it must have an entry for every slot and every entry
+// must be a shard number between 1 and 10_000.
+func validateSlotTable(table []int, slotsCount int) error {
+	if len(table) != slotsCount {
+		return fmt.Errorf("slot table must have %d slots, got %d",
+			slotsCount, len(table))
+	}
+
+	for slot, shard := range table {
+		if shard < 1 || shard > maxShardsCount {
+			return fmt.Errorf("slot %d shard must be between 1 and %d, got %d",
+				slot, maxShardsCount, shard)
+		}
+	}
+
+	return nil
+}
+
 // MakeKeyWrapper creates a new KeyWrapper that will be updated whenever
 // the factory's shard count changes (both increases and decreases).
 // The returned wrapper is registered with the factory and will automatically
@@ -77,10 +380,7 @@ func (f *Factory) MakeKeyWrapper() KeyWrapper {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	w := newKeyWrapper(f.shardsCount)
-	f.generalWrappers.add(w)
-
-	return w
+	return f.register(f.generalWrappers, newSnapshotKeyWrapper(f.shards, f.format, f.counterStripes))
 }
 
 // MakeOnlyGrowingKeyWrapper creates a new KeyWrapper that will only be updated
@@ -91,10 +391,159 @@ func (f *Factory) MakeOnlyGrowingKeyWrapper() KeyWrapper {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	w := newKeyWrapper(f.shardsCount)
-	f.onlyGrowingWrappers.add(w)
+	return f.register(f.onlyGrowingWrappers, newSnapshotKeyWrapper(f.shards, f.format, f.counterStripes))
+}
+
+// MakeHashKeyWrapper creates a new KeyWrapper that picks the shard postfix
+// from a hash of the key, so the same key is always wrapped the same way
+// for a given shard count. Like MakeKeyWrapper, the returned wrapper is
+// updated whenever the factory's shard count changes.
+func (f *Factory) MakeHashKeyWrapper() KeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	return w
+	return f.register(f.generalWrappers, newSnapshotHashKeyWrapper(f.shards, f.format, moduloShard))
+}
+
+// MakeJumpHashKeyWrapper creates a new KeyWrapper that picks the shard postfix
+// with jump consistent hashing of the key. When the shard count grows from N
+// to N+1, only about 1/(N+1) of the keys move to another shard.
+// The returned wrapper is updated whenever the factory's shard count changes.
+func (f *Factory) MakeJumpHashKeyWrapper() KeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.register(f.generalWrappers, newSnapshotHashKeyWrapper(f.shards, f.format, jumpShard))
+}
+
+// MakeOnlyGrowingJumpHashKeyWrapper creates a new jump consistent hash KeyWrapper
+// that will only be updated when the factory's shard count increases.
+func (f *Factory) MakeOnlyGrowingJumpHashKeyWrapper() KeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.register(f.onlyGrowingWrappers, newSnapshotHashKeyWrapper(f.shards, f.format, jumpShard))
+}
+
+// MakeRendezvousKeyWrapper creates a new KeyWrapper that picks a shard by
+// rendezvous (highest random weight) hashing over the factory's shard IDs
+// and appends the winning ID as the postfix (e.g., "user:123:redis-b").
+// Until shard IDs are provided by the Interrogator, the IDs "1".."shardsCount"
+// are used and follow the shard count.
+func (f *Factory) MakeRendezvousKeyWrapper() KeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.register(f.namedWrappers, newRendezvousKeyWrapper(f.activeShardIDs(), f.format))
+}
+
+// MakeWeightedKeyWrapper creates a new KeyWrapper that distributes keys over
+// ":1".."N" proportionally to the factory's shard weights using smooth
+// weighted round-robin. Until weights are provided by the Interrogator,
+// every shard has weight 1 and the shard set follows the shard count.
+func (f *Factory) MakeWeightedKeyWrapper() KeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.register(f.weightedWrappers, newWeightedKeyWrapper(f.activeShardWeights(), f.format))
+}
+
+// MakeSlotKeyWrapper creates a new KeyWrapper that hashes keys into the
+// factory's logical slots and appends the postfix of the shard owning the slot.
+// Until a slot table is provided by the Interrogator, the slots are split
+// into equal contiguous ranges over the current shard count, with the moves
+// of completed slot migrations applied until the next shard count change.
+// The returned wrapper also follows in-flight slot migrations.
+func (f *Factory) MakeSlotKeyWrapper() SlotKeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.register(f.slotWrappers, newSlotKeyWrapper(f.activeSlotTable(), f.slotMigrations, f.format)).(SlotKeyWrapper)
+}
+
+// MakeRedisClusterKeyWrapper creates a new KeyWrapper for Redis Cluster.
+// Every master of the factory's cluster slot map is a logical shard, and keys
+// rotate over the shards in round-robin order. A key is wrapped into a hash tag
+// whose CRC16 slot is served by the shard's master (e.g., "{user:123:s1}",
+// "{user:123:s2.5}"), so consecutive keys land on different masters.
+// Keys with a hash tag keep it, with the shard salt added inside ("{user:s1}:123").
+// Keys whose tag search fails are counted in FactoryStats.ClusterTagMisses.
+// Until the slot map is provided by the Interrogator, all keys are wrapped
+// for a single shard.
+func (f *Factory) MakeRedisClusterKeyWrapper() KeyWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.register(f.clusterWrappers, newRedisClusterKeyWrapperWithTagger(f.clusterTagger, f.format, f.clusterTagMisses))
+}
+
+// KeySlot returns the logical slot the key is hashed into by slot wrappers.
+func (f *Factory) KeySlot(key string) int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return keySlot(key, f.slotsCount)
+}
+
+// SlotChanges returns the slots that changed owner on the last slot table
+// change, either from an explicit table update or, while no table is set,
+// from a shard count change. It returns nil if no slot has moved yet.
+// Use SubscribeSlotChanges to observe the moves of every update.
+func (f *Factory) SlotChanges() []SlotChange {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.slotChanges == nil {
+		return nil
+	}
+
+	changes := make([]SlotChange, len(f.slotChanges))
+	copy(changes, f.slotChanges)
+
+	return changes
+}
+
+// SlotMigrations returns the in-flight slot migrations ordered by slot.
+func (f *Factory) SlotMigrations() []SlotMigration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return sortedSlotMigrations(f.slotMigrations)
+}
+
+// activeSlotTable returns the slot table slot wrappers should use.
+// The caller must hold f.mu.
+func (f *Factory) activeSlotTable() []int {
+	if f.slotTable != nil {
+		return f.slotTable
+	}
+
+	table := defaultSlotTable(f.slotsCount, f.shardsCount)
+	for slot, shard := range f.slotOverrides {
+		table[slot] = shard
+	}
+
+	return table
+}
+
+// activeShardWeights returns the shard weights weighted wrappers should use.
+// The caller must hold f.mu.
+func (f *Factory) activeShardWeights() []int {
+	if f.shardWeights != nil {
+		return f.shardWeights
+	}
+
+	return defaultShardWeights(f.shardsCount)
+}
+
+// activeShardIDs returns the shard IDs named wrappers should use.
+// The caller must hold f.mu.
+func (f *Factory) activeShardIDs() []string {
+	if f.shardIDs != nil {
+		return f.shardIDs
+	}
+
+	return defaultShardIDs(f.shardsCount)
 }
 
 // compareAndUpdate updates the factory's shard count if it differs from the new value.
@@ -102,12 +551,28 @@ func (f *Factory) MakeOnlyGrowingKeyWrapper() KeyWrapper {
 // It validates the new count and updates appropriate wrappers based on their type:
 // - General wrappers are always updated
 // - Growing-only wrappers are updated only when shard count increases
+//
+// The high-water mark is persisted afterwards, and a failed save is retried
+// on the next call; its error is returned once the shard count is applied.
 func (f *Factory) compareAndUpdate(shardCount int) error {
 	f.mu.Lock()
-	defer f.mu.Unlock()
+	err := f.updateShardsCount(shardCount)
+	f.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
 
+	return f.saveHighWater()
+}
+
+// updateShardsCount applies a new shard count to the factory and its wrappers
+// and drops any pending shard count. It raises the in-memory high-water mark,
+// which the caller persists with saveHighWater. The caller must hold f.mu.
+func (f *Factory) updateShardsCount(shardCount int) error {
 	if shardCount == f.shardsCount {
 		// No change in shard count
+		f.pendingShardsCount = noPendingShardsCount
 		return nil
 	}
 
@@ -116,17 +581,454 @@ func (f *Factory) compareAndUpdate(shardCount int) error {
 		return err
 	}
 
-	f.generalWrappers.update(shardCount)
+	f.pendingShardsCount = noPendingShardsCount
+
+	if err := f.approveShardChange(shardCount); err != nil {
+		return err
+	}
+
+	// one snapshot is shared by all wrappers, so updating a wrapper is a pointer swap
+	snap := newShardSnapshot(shardCount, f.format)
+
+	kinds := GeneralKind
+	f.generalWrappers.update(snap)
 
 	if shardCount > f.shardsCount {
-		f.onlyGrowingWrappers.update(shardCount)
+		kinds |= GrowingKind
+		f.onlyGrowingWrappers.update(snap)
 	}
 
+	if shardCount > f.highWaterShardsCount {
+		f.highWaterShardsCount = shardCount
+	}
+
+	if f.slotTable == nil {
+		// the default table is laid out anew for the new shard count,
+		// so slots moved by completed migrations return to their range
+		oldTable := f.activeSlotTable()
+		newTable := defaultSlotTable(f.slotsCount, shardCount)
+		f.slotOverrides = nil
+
+		kinds |= SlotKind
+		f.slotWrappers.update(newTable)
+		f.recordSlotChanges(oldTable, newTable)
+	}
+
+	oldCount := f.shardsCount
 	f.shardsCount = shardCount
+	f.shards = snap
+
+	if f.shardIDs == nil {
+		kinds |= NamedKind
+		f.namedWrappers.update(defaultShardIDs(shardCount))
+	}
+
+	if f.shardWeights == nil {
+		kinds |= WeightedKind
+		f.weightedWrappers.update(defaultShardWeights(shardCount))
+	}
+
+	f.publish(ShardChangeEvent{
+		OldShards: oldCount,
+		NewShards: shardCount,
+		Time:      f.clock.Now(),
+		Kinds:     kinds,
+	})
 
 	return nil
 }
 
+// prepareUpdate starts the first phase of a two-phase shard count change.
+// The new count becomes pending: read-side APIs such as ReadShardsCount already
+// cover it, while wrappers keep using the current count until CommitPending is called.
+// It reports whether a new pending count was prepared, so the caller can schedule
+// the commit. A count equal to the current one cancels the pending change.
+// This method is called by the Interrogator when Config.CommitDelay is set.
+func (f *Factory) prepareUpdate(shardCount int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if shardCount == f.shardsCount {
+		// Shard count is back to the current one
+		f.pendingShardsCount = noPendingShardsCount
+		return false, nil
+	}
+
+	if shardCount == f.pendingShardsCount {
+		// Already prepared
+		return false, nil
+	}
+
+	if err := validateShardsCount(shardCount); err != nil {
+		return false, err
+	}
+
+	if err := f.approveShardChange(shardCount); err != nil {
+		return false, err
+	}
+
+	f.pendingShardsCount = shardCount
+
+	return true, nil
+}
+
+// CommitPending completes a two-phase shard count change by applying the
+// pending shard count to all wrappers. It does nothing if no change is pending.
+// The Interrogator commits automatically once Config.CommitDelay has passed;
+// CommitPending can be used to commit earlier, e.g. once all readers are known
+// to cover the new shard set.
+// Like a direct update, it persists the high-water mark afterwards, retrying
+// an earlier failed save.
+func (f *Factory) CommitPending() error {
+	f.mu.Lock()
+
+	var err error
+	if f.pendingShardsCount != noPendingShardsCount {
+		err = f.updateShardsCount(f.pendingShardsCount)
+	}
+
+	f.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return f.saveHighWater()
+}
+
+// ReadShardsCount returns the number of shards readers should cover.
+// While a shard count change is pending, it is the larger of the current
+// and the pending count, so readers see the new shards before writers use them.
+// Shards used only by explicit weights, the slot table or slot migrations
+// are covered as well.
+func (f *Factory) ReadShardsCount() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.readShardsCount()
+}
+
+// AllKeys returns the base key wrapped with every postfix that is currently
+// in use: ":1".."N", where N is ReadShardsCount. Readers of round-robin
+// sharded data can use it to fan out over all shards without guessing N.
+// Keys written by Redis Cluster wrappers are covered by AllClusterKeys instead.
+// Example: "user:123" -> ["user:123:1", "user:123:2", "user:123:3"]
+func (f *Factory) AllKeys(base string) []string {
+	f.mu.RLock()
+	count := f.readShardsCount()
+	f.mu.RUnlock()
+
+	return f.format.wrapAll(base, count)
+}
+
+// AllOnlyGrowingKeys returns the base key wrapped with every postfix that
+// only-growing wrappers may have used. Since only-growing wrappers ignore
+// shard count decreases, it covers the highest shard count the factory has
+// ever applied instead of the current count.
+func (f *Factory) AllOnlyGrowingKeys(base string) []string {
+	f.mu.RLock()
+	count := f.readShardsCount()
+	if f.highWaterShardsCount > count {
+		count = f.highWaterShardsCount
+	}
+	f.mu.RUnlock()
+
+	return f.format.wrapAll(base, count)
+}
+
+// AllClusterKeys returns the base key wrapped for every shard of Redis Cluster
+// wrappers, found with the same hash tag search over the current slot map.
+// Readers can use it to fan out over the keys written by Redis Cluster wrappers.
+// Example with three masters:
+// "user:123" -> ["{user:123:s1.3}", "{user:123:s2}", "{user:123:s3.2}"]
+func (f *Factory) AllClusterKeys(base string) []string {
+	f.mu.RLock()
+	tagger := f.clusterTagger
+	f.mu.RUnlock()
+
+	keys := make([]string, tagger.shards())
+	for i := range keys {
+		keys[i], _ = tagger.tag(base, i+1)
+	}
+
+	return keys
+}
+
+// ParseWrappedKey is the inverse of WrapKey for numbered shard postfixes
+// in the factory's format. It returns the base key and the 1-based shard number.
+// Example: "user:123:4" -> "user:123", 4; or "004/user:123" -> "user:123", 4
+// with Formatter{Delimiter: "/", Width: 3, Prefix: true}.
+func (f *Factory) ParseWrappedKey(wrapped string) (string, int, error) {
+	return f.format.ParseWrappedKey(wrapped)
+}
+
+// readShardsCount returns the number of shards readers should cover.
+// The caller must hold f.mu.
+func (f *Factory) readShardsCount() int {
+	count := f.shardsCount
+
+	if f.pendingShardsCount > count {
+		count = f.pendingShardsCount
+	}
+
+	if len(f.shardWeights) > count {
+		count = len(f.shardWeights)
+	}
+
+	for _, shard := range f.slotTable {
+		if shard > count {
+			count = shard
+		}
+	}
+
+	for _, shard := range f.slotOverrides {
+		if shard > count {
+			count = shard
+		}
+	}
+
+	for _, m := range f.slotMigrations {
+		if m.Target > count {
+			count = m.Target
+		}
+	}
+
+	if count < 1 {
+		count = 1
+	}
+
+	return count
+}
+
+// compareAndUpdateShardIDs updates the factory's shard IDs if they differ
+// from the new set. The order of the identifiers does not matter.
+// This method is called by the Interrogator to apply shard ID changes
+// to all named wrappers.
+func (f *Factory) compareAndUpdateShardIDs(ids []string) error {
+	if err := validateShardIDs(ids); err != nil {
+		return err
+	}
+
+	sorted := make([]string, len(ids))
+	copy(sorted, ids)
+	sort.Strings(sorted)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if equalStrings(sorted, f.shardIDs) {
+		// No change in shard IDs
+		return nil
+	}
+
+	f.namedWrappers.update(sorted)
+	f.shardIDs = sorted
+
+	return nil
+}
+
+// compareAndUpdateSlotTable updates the factory's slot table if it differs
+// from the new one and records the slots that changed owner.
+// table[slot] is the shard number owning the slot.
+// This method is called by the Interrogator to apply slot table changes
+// to all slot wrappers.
+func (f *Factory) compareAndUpdateSlotTable(table []int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := validateSlotTable(table, f.slotsCount); err != nil {
+		return err
+	}
+
+	oldTable := f.activeSlotTable()
+	if equalInts(table, oldTable) {
+		// No change in slot table
+		f.slotTable = oldTable
+		f.slotOverrides = nil
+		return nil
+	}
+
+	copied := make([]int, len(table))
+	copy(copied, table)
+
+	f.slotWrappers.update(copied)
+	f.recordSlotChanges(oldTable, copied)
+	f.slotTable = copied
+	f.slotOverrides = nil
+
+	return nil
+}
+
+// compareAndUpdateSlotMigrations applies the in-flight slot migrations
+// reported by the source. Every slot must follow the state machine
+// stable -> migrating -> importing -> stable; a slot that is no longer
+// reported completes its migration if it was importing, so its target
+// becomes the owner in the slot table, or aborts it if it was migrating.
+// While no slot table is set, completed moves are kept on top of the default
+// table until the next shard count change lays the default table out anew.
+// Invalid transitions are rejected with a *SlotTransitionError and
+// leave the current state untouched.
+// This method is called by the Interrogator to drive slot migrations.
+func (f *Factory) compareAndUpdateSlotMigrations(migrations []SlotMigration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table := f.activeSlotTable()
+
+	next, err := nextSlotMigrations(f.slotMigrations, migrations, table)
+	if err != nil {
+		return err
+	}
+
+	if equalSlotMigrations(next, f.slotMigrations) {
+		// No change in slot migrations
+		return nil
+	}
+
+	var completed []SlotChange
+	for slot, m := range f.slotMigrations {
+		if _, ok := next[slot]; ok || m.State != SlotImporting {
+			continue
+		}
+
+		completed = append(completed, SlotChange{Slot: slot, From: m.Source, To: m.Target})
+	}
+
+	if len(completed) > 0 {
+		newTable := make([]int, len(table))
+		copy(newTable, table)
+
+		for _, c := range completed {
+			newTable[c.Slot] = c.To
+		}
+
+		if f.slotTable != nil {
+			f.slotTable = newTable
+		} else {
+			// keep following shard count changes with the default table
+			if f.slotOverrides == nil {
+				f.slotOverrides = make(map[int]int, len(completed))
+			}
+
+			for _, c := range completed {
+				f.slotOverrides[c.Slot] = c.To
+			}
+		}
+
+		f.slotWrappers.update(newTable)
+		f.recordSlotChanges(table, newTable)
+	}
+
+	f.slotWrappers.update(next)
+	f.slotMigrations = next
+
+	return nil
+}
+
+// compareAndUpdateClusterSlots updates the factory's Redis Cluster slot map
+// if it differs from the new one. The order of the ranges does not matter.
+// This method is called by the Interrogator to apply slot map changes
+// to all Redis Cluster wrappers.
+func (f *Factory) compareAndUpdateClusterSlots(ranges []ClusterSlotRange) error {
+	if err := validateClusterSlots(ranges); err != nil {
+		return err
+	}
+
+	sorted := make([]ClusterSlotRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if equalClusterSlots(sorted, f.clusterSlots) {
+		// No change in cluster slot map
+		return nil
+	}
+
+	// one tagger is shared by all wrappers and AllClusterKeys
+	tagger := newClusterTagger(sorted, f.format)
+
+	f.clusterWrappers.update(tagger)
+	f.clusterSlots = sorted
+	f.clusterTagger = tagger
+
+	return nil
+}
+
+// compareAndUpdateShardWeights updates the factory's shard weights if they
+// differ from the new values. weights[i] is the weight of shard ":i+1".
+// This method is called by the Interrogator to apply weight changes
+// to all weighted wrappers.
+func (f *Factory) compareAndUpdateShardWeights(weights []int) error {
+	if err := validateShardWeights(weights); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if equalInts(weights, f.shardWeights) {
+		// No change in shard weights
+		return nil
+	}
+
+	copied := make([]int, len(weights))
+	copy(copied, weights)
+
+	f.weightedWrappers.update(copied)
+	f.shardWeights = copied
+
+	return nil
+}
+
+// equalInts reports whether a and b contain the same ints in the same order.
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalClusterSlots reports whether a and b contain the same ranges in the same order.
+func equalClusterSlots(a, b []ClusterSlotRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalStrings reports whether a and b contain the same strings in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Stats returns current statistics about the factory.
 // The returned FactoryStats contains information about shard count
 // and the number of registered wrappers of each type.
@@ -135,9 +1037,50 @@ func (f *Factory) Stats() FactoryStats {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
+	ids := f.activeShardIDs()
+	shardIDs := make([]string, len(ids))
+	copy(shardIDs, ids)
+
+	var migrating, importing int
+	for _, m := range f.slotMigrations {
+		switch m.State {
+		case SlotMigrating:
+			migrating++
+		case SlotImporting:
+			importing++
+		}
+	}
+
+	var pending int
+	if f.pendingShardsCount != noPendingShardsCount {
+		pending = f.pendingShardsCount
+	}
+
+	activeWeights := f.activeShardWeights()
+	weights := make([]int, len(activeWeights))
+	copy(weights, activeWeights)
+
 	return FactoryStats{
-		Shards:          f.shardsCount,
-		GeneralWrappers: len(f.generalWrappers.wrappers),
-		GrowingWrappers: len(f.onlyGrowingWrappers.wrappers),
+		Shards:               f.shardsCount,
+		PendingShards:        pending,
+		HighWaterShards:      f.highWaterShardsCount,
+		GeneralWrappers:      len(f.generalWrappers.wrappers),
+		GrowingWrappers:      len(f.onlyGrowingWrappers.wrappers),
+		NamedWrappers:        len(f.namedWrappers.wrappers),
+		WeightedWrappers:     len(f.weightedWrappers.wrappers),
+		SlotWrappers:         len(f.slotWrappers.wrappers),
+		ClusterWrappers:      len(f.clusterWrappers.wrappers),
+		Slots:                f.slotsCount,
+		MigratingSlots:       migrating,
+		ImportingSlots:       importing,
+		ClusterNodes:         len(clusterNodes(f.clusterSlots)),
+		ClusterTagMisses:     int(atomic.LoadInt64(f.clusterTagMisses)),
+		Subscribers:          len(f.subscriptions),
+		DroppedShardEvents:   f.droppedShardEvents,
+		SlotSubscribers:      len(f.slotSubscriptions),
+		DroppedSlotEvents:    f.droppedSlotEvents,
+		RejectedShardChanges: f.rejectedShardChanges,
+		ShardIDs:             shardIDs,
+		Weights:              weights,
 	}
 }
@@ -1,9 +1,11 @@
 package key_wrapper
 
 import (
+	"runtime"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestFactory(t *testing.T) {
@@ -89,10 +91,47 @@ func BenchmarkWrapKey(b *testing.B) {
 	factory, _ := NewFactory(10)
 	wrapper := factory.MakeKeyWrapper()
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		wrapper.WrapKey("testkey")
+	b.Run("WrapKey", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			wrapper.WrapKey("testkey")
+		}
+	})
+
+	b.Run("AppendWrappedKey", func(b *testing.B) {
+		aw := wrapper.(AppendKeyWrapper)
+		buf := make([]byte, 0, 64)
+
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			buf = aw.AppendWrappedKey(buf[:0], "testkey")
+		}
+	})
+}
+
+func BenchmarkWrapKeyParallel(b *testing.B) {
+	run := func(b *testing.B, opts ...FactoryOption) {
+		factory, _ := NewFactory(10, opts...)
+		wrapper := factory.MakeKeyWrapper().(AppendKeyWrapper)
+
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			buf := make([]byte, 0, 64)
+			for pb.Next() {
+				buf = wrapper.AppendWrappedKey(buf[:0], "testkey")
+			}
+		})
 	}
+
+	b.Run("single", func(b *testing.B) {
+		run(b)
+	})
+
+	b.Run("striped", func(b *testing.B) {
+		run(b, WithStripedCounters(runtime.GOMAXPROCS(0)))
+	})
 }
 
 func TestConcurrentAccess(t *testing.T) {
@@ -111,3 +150,159 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestFactory_TwoPhaseUpdate(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeKeyWrapper()
+
+	prepared, err := f.prepareUpdate(3)
+	if err != nil {
+		t.Fatalf("prepareUpdate: %v", err)
+	}
+
+	if !prepared {
+		t.Fatal("expected shard count to be prepared")
+	}
+
+	// preparing the same count again does not restart the change
+	if prepared, _ := f.prepareUpdate(3); prepared {
+		t.Fatal("expected shard count to be already prepared")
+	}
+
+	if got := f.ReadShardsCount(); got != 3 {
+		t.Fatalf("expected readers to cover 3 shards, got %d", got)
+	}
+
+	if stats := f.Stats(); stats.Shards != 2 || stats.PendingShards != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// writers stay on the old count
+	for _, exp := range []string{"key:1", "key:2", "key:1"} {
+		if got := w.WrapKey("key"); got != exp {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	}
+
+	if err := f.CommitPending(); err != nil {
+		t.Fatalf("CommitPending: %v", err)
+	}
+
+	for _, exp := range []string{"key:2", "key:3", "key:1"} {
+		if got := w.WrapKey("key"); got != exp {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	}
+
+	if stats := f.Stats(); stats.Shards != 3 || stats.PendingShards != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// nothing to commit
+	if err := f.CommitPending(); err != nil {
+		t.Fatalf("CommitPending: %v", err)
+	}
+
+	// reverting to the current count cancels the pending change
+	if _, err := f.prepareUpdate(5); err != nil {
+		t.Fatalf("prepareUpdate: %v", err)
+	}
+
+	if _, err := f.prepareUpdate(3); err != nil {
+		t.Fatalf("prepareUpdate: %v", err)
+	}
+
+	if stats := f.Stats(); stats.PendingShards != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if _, err := f.prepareUpdate(maxShardsCount + 1); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestFactory_AllKeys(t *testing.T) {
+	f, err := NewFactory(3)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	check := func(got, exp []string) {
+		t.Helper()
+
+		if !equalStrings(got, exp) {
+			t.Fatalf("got=%v, exp=%v", got, exp)
+		}
+	}
+
+	check(f.AllKeys("key"), []string{"key:1", "key:2", "key:3"})
+	check(f.AllOnlyGrowingKeys("key"), []string{"key:1", "key:2", "key:3"})
+
+	// a prepared count is already covered by readers
+	if _, err := f.prepareUpdate(4); err != nil {
+		t.Fatalf("prepareUpdate: %v", err)
+	}
+
+	check(f.AllKeys("key"), []string{"key:1", "key:2", "key:3", "key:4"})
+
+	if err := f.CommitPending(); err != nil {
+		t.Fatalf("CommitPending: %v", err)
+	}
+
+	// only-growing keys keep covering the high-water mark after a decrease
+	if err := f.compareAndUpdate(2); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	check(f.AllKeys("key"), []string{"key:1", "key:2"})
+	check(f.AllOnlyGrowingKeys("key"), []string{"key:1", "key:2", "key:3", "key:4"})
+
+	// shards used only by explicit weights are covered as well
+	if err := f.compareAndUpdateShardWeights([]int{1, 1, 1, 1, 1}); err != nil {
+		t.Fatalf("compareAndUpdateShardWeights: %v", err)
+	}
+
+	check(f.AllKeys("key"), []string{"key:1", "key:2", "key:3", "key:4", "key:5"})
+}
+
+func TestWithClock(t *testing.T) {
+	if _, err := NewFactory(1, WithClock(nil)); err == nil {
+		t.Fatal("expected error for nil clock, got nil")
+	}
+
+	clock := &fixedClock{now: time.Unix(42, 0)}
+
+	f, err := NewFactory(1, WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	events, cancel := f.Subscribe(1)
+	defer cancel()
+
+	if err := f.compareAndUpdate(2); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	if ev := <-events; !ev.Time.Equal(clock.now) {
+		t.Fatalf("got=%s, exp=%s", ev.Time, clock.now)
+	}
+
+	if got := (&Config{Factory: f}).clock(); got != Clock(clock) {
+		t.Fatalf("got=%v, exp=the factory clock", got)
+	}
+}
+
+// fixedClock is a Clock that always returns the same time.
+type fixedClock struct {
+	realClock
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
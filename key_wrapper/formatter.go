@@ -0,0 +1,229 @@
+package key_wrapper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultDelimiter separates the key and the shard ID
+	// when Formatter.Delimiter is empty.
+	defaultDelimiter = ":"
+	// maxFormatterWidth limits the zero padding of shard IDs.
+	maxFormatterWidth = 20
+)
+
+// Formatter defines how shard IDs are rendered and attached to keys.
+// The factory passes its formatter to every wrapper it creates, so the same
+// machinery can shard Redis keys, SQL table names, S3 paths or Kafka topics.
+//
+// The zero value produces the default format: "user:123:1".."user:123:N".
+type Formatter struct {
+	// Delimiter separates the key and the shard ID. Defaults to ":".
+	Delimiter string
+	// Width is the minimum number of digits of a shard ID.
+	// Shorter IDs are padded with zeros, e.g. Width 3 gives ":007".
+	Width int
+	// ZeroBased numbers shards from 0 instead of 1.
+	ZeroBased bool
+	// Base is the numeral base of shard IDs, from 2 to 36. Defaults to 10.
+	// Base 36 gives compact IDs such as ":a" for the tenth shard.
+	Base int
+	// Prefix places the shard ID before the key ("3:user:123")
+	// instead of after it ("user:123:3").
+	Prefix bool
+}
+
+// Validate checks that the formatter settings can be used.
+func (f Formatter) Validate() error {
+	if f.Base != 0 && (f.Base < 2 || f.Base > 36) {
+		return fmt.Errorf("formatter base must be between 2 and 36, got %d", f.Base)
+	}
+
+	if f.Width < 0 || f.Width > maxFormatterWidth {
+		return fmt.Errorf("formatter width must be between 0 and %d, got %d",
+			maxFormatterWidth, f.Width)
+	}
+
+	return nil
+}
+
+// FormatShard returns the shard ID of the shard with the given 1-based number.
+// Example: shard 7 -> "7", or "007" with Width 3, or "6" with ZeroBased.
+func (f Formatter) FormatShard(shard int) string {
+	if f.ZeroBased {
+		shard--
+	}
+
+	id := strconv.FormatInt(int64(shard), f.base())
+	if len(id) < f.Width {
+		id = strings.Repeat("0", f.Width-len(id)) + id
+	}
+
+	return id
+}
+
+// ParseShard is the inverse of FormatShard. It returns the 1-based shard
+// number of the shard ID and reports whether the ID is one FormatShard
+// could have produced.
+func (f Formatter) ParseShard(id string) (int, bool) {
+	if id == "" {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(id, f.base(), 32)
+	if err != nil {
+		return 0, false
+	}
+
+	shard := int(n)
+	if f.ZeroBased {
+		shard++
+	}
+
+	if shard < 1 || shard > maxShardsCount {
+		return 0, false
+	}
+
+	// reject IDs that do not match the format exactly, e.g. missing padding
+	if f.FormatShard(shard) != id {
+		return 0, false
+	}
+
+	return shard, true
+}
+
+// JoinKey attaches the shard ID to the key.
+// Example: "user:123", "3" -> "user:123:3", or "3:user:123" with Prefix.
+func (f Formatter) JoinKey(key, id string) string {
+	if f.Prefix {
+		return id + f.delimiter() + key
+	}
+
+	return key + f.delimiter() + id
+}
+
+// SplitKey is the inverse of JoinKey. It returns the key and the shard ID
+// of the wrapped key. Since keys may contain the delimiter themselves,
+// the shard ID is taken from the first delimiter with Prefix,
+// or from the last one otherwise.
+func (f Formatter) SplitKey(wrapped string) (string, string, error) {
+	delim := f.delimiter()
+
+	var key, id string
+	if f.Prefix {
+		i := strings.Index(wrapped, delim)
+		if i < 0 {
+			return "", "", &ParseError{Key: wrapped, Err: ErrMissingPostfix}
+		}
+
+		key, id = wrapped[i+len(delim):], wrapped[:i]
+	} else {
+		i := strings.LastIndex(wrapped, delim)
+		if i < 0 {
+			return "", "", &ParseError{Key: wrapped, Err: ErrMissingPostfix}
+		}
+
+		key, id = wrapped[:i], wrapped[i+len(delim):]
+	}
+
+	if key == "" {
+		return "", "", &ParseError{Key: wrapped, Err: ErrEmptyBaseKey}
+	}
+
+	return key, id, nil
+}
+
+// ParseWrappedKey is the inverse of wrapping a key with a numbered shard
+// in this format. It returns the base key and the 1-based shard number.
+// Example: "user:123:4" -> "user:123", 4
+func (f Formatter) ParseWrappedKey(wrapped string) (string, int, error) {
+	key, id, err := f.SplitKey(wrapped)
+	if err != nil {
+		return "", 0, err
+	}
+
+	shard, ok := f.ParseShard(id)
+	if !ok {
+		return "", 0, &ParseError{Key: wrapped, Err: ErrInvalidShard}
+	}
+
+	return key, shard, nil
+}
+
+// wrap attaches the ID of the shard with the given 1-based number to the key.
+func (f Formatter) wrap(key string, shard int) string {
+	return f.JoinKey(key, f.FormatShard(shard))
+}
+
+// affix returns the part attached to a key for the shard with the given
+// 1-based number: the delimiter followed by the shard ID, or the shard ID
+// followed by the delimiter with Prefix.
+func (f Formatter) affix(shard int) string {
+	if f.Prefix {
+		return f.FormatShard(shard) + f.delimiter()
+	}
+
+	return f.delimiter() + f.FormatShard(shard)
+}
+
+// affixes returns the affixes of shards 1..count, with at least one entry.
+func (f Formatter) affixes(count int) []string {
+	if count < 1 {
+		count = 1
+	}
+
+	table := make([]string, count)
+	for i := range table {
+		table[i] = f.affix(i + 1)
+	}
+
+	return table
+}
+
+// attach attaches a precomputed affix to the key.
+func (f Formatter) attach(key, affix string) string {
+	if f.Prefix {
+		return affix + key
+	}
+
+	return key + affix
+}
+
+// appendAttached appends the key with a precomputed affix to dst.
+func (f Formatter) appendAttached(dst []byte, key, affix string) []byte {
+	if f.Prefix {
+		return append(append(dst, affix...), key...)
+	}
+
+	return append(append(dst, key...), affix...)
+}
+
+// wrapAll returns the key wrapped with the IDs of shards 1..count.
+func (f Formatter) wrapAll(key string, count int) []string {
+	keys := make([]string, count)
+	for i := range keys {
+		keys[i] = f.wrap(key, i+1)
+	}
+
+	return keys
+}
+
+// delimiter returns the configured delimiter or the default one.
+func (f Formatter) delimiter() string {
+	if f.Delimiter == "" {
+		return defaultDelimiter
+	}
+
+	return f.Delimiter
+}
+
+// base returns the configured numeral base or the default one.
+func (f Formatter) base() int {
+	if f.Base == 0 {
+		return 10
+	}
+
+	return f.Base
+}
@@ -0,0 +1,101 @@
+package key_wrapper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Formatter
+		shard   int
+		wrapped string
+	}{
+		{"default", Formatter{}, 3, "user:123:3"},
+		{"delimiter", Formatter{Delimiter: "_"}, 3, "user:123_3"},
+		{"zero padded", Formatter{Width: 3}, 7, "user:123:007"},
+		{"zero based", Formatter{ZeroBased: true}, 1, "user:123:0"},
+		{"base36", Formatter{Base: 36}, 35, "user:123:z"},
+		{"prefix", Formatter{Prefix: true}, 3, "3:user:123"},
+		{"s3 path", Formatter{Delimiter: "/", Width: 2, Prefix: true}, 4, "04/user:123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+
+			if got := tt.format.wrap("user:123", tt.shard); got != tt.wrapped {
+				t.Fatalf("got=%s, exp=%s", got, tt.wrapped)
+			}
+
+			base, shard, err := tt.format.ParseWrappedKey(tt.wrapped)
+			if err != nil {
+				t.Fatalf("ParseWrappedKey: %v", err)
+			}
+
+			if base != "user:123" || shard != tt.shard {
+				t.Fatalf("got (%s, %d), exp (user:123, %d)", base, shard, tt.shard)
+			}
+		})
+	}
+}
+
+func TestFormatter_ParseShard(t *testing.T) {
+	invalid := map[string]Formatter{
+		"7":     {Width: 3},        // missing padding
+		"0":     {},                // not one-based
+		"Z":     {Base: 36},        // not canonical
+		"10000": {ZeroBased: true}, // out of range
+	}
+
+	for id, format := range invalid {
+		if _, ok := format.ParseShard(id); ok {
+			t.Fatalf("%q with %+v: expected invalid shard", id, format)
+		}
+	}
+}
+
+func TestFormatter_Validate(t *testing.T) {
+	for _, format := range []Formatter{{Base: 1}, {Base: 37}, {Width: -1}, {Width: maxFormatterWidth + 1}} {
+		if err := format.Validate(); err == nil {
+			t.Fatalf("%+v: expected error, got nil", format)
+		}
+	}
+}
+
+func TestFactory_WithFormatter(t *testing.T) {
+	format := Formatter{Delimiter: "_", Width: 2}
+
+	f, err := NewFactory(3, WithFormatter(format))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeKeyWrapper()
+	for _, exp := range []string{"table_01", "table_02", "table_03", "table_01"} {
+		if got := w.WrapKey("table"); got != exp {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	}
+
+	keys := f.AllKeys("table")
+	if !equalStrings(keys, []string{"table_01", "table_02", "table_03"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	base, shard, err := f.ParseWrappedKey("table_02")
+	if err != nil || base != "table" || shard != 2 {
+		t.Fatalf("got (%s, %d, %v)", base, shard, err)
+	}
+
+	if _, _, err := f.ParseWrappedKey("table:2"); !errors.Is(err, ErrMissingPostfix) {
+		t.Fatalf("expected ErrMissingPostfix, got %v", err)
+	}
+
+	if _, err := NewFactory(1, WithFormatter(Formatter{Base: 64})); err == nil {
+		t.Fatal("expected error for invalid formatter, got nil")
+	}
+}
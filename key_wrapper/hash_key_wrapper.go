@@ -0,0 +1,116 @@
+package key_wrapper
+
+import (
+	"sync/atomic"
+)
+
+const (
+	// fnvOffset64 and fnvPrime64 are the 64-bit FNV-1a parameters.
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// Compile-time interface compliance checks
+var _ KeyWrapper = (*hashKeyWrapper)(nil)
+var _ ResetShards = (*hashKeyWrapper)(nil)
+
+// shardPicker maps a key hash to a zero-based shard index in [0, count).
+type shardPicker func(hash uint64, count int) int
+
+// hashKeyWrapper is a KeyWrapper that derives the shard postfix from a hash
+// of the key instead of a rotating counter. The same key always gets the same
+// postfix for a given shard count, so readers can compute the shard of a key
+// without fanning out over all of them.
+//
+// Like keyWrapper, it reads the shard count from an immutable snapshot
+// that is swapped atomically on shard count changes.
+type hashKeyWrapper struct {
+	snapshot atomic.Value // current *shardSnapshot, replaced on shard count changes
+	pick     shardPicker  // strategy mapping a key hash to a shard
+	format   Formatter    // renders shard postfixes
+}
+
+// newHashKeyWrapper creates a new hashKeyWrapper instance with the specified
+// shard count that maps hashes to shards with a plain modulo.
+func newHashKeyWrapper(count int, format Formatter) *hashKeyWrapper {
+	return newHashKeyWrapperWithPicker(count, format, moduloShard)
+}
+
+// newJumpHashKeyWrapper creates a new hashKeyWrapper instance with the specified
+// shard count that maps hashes to shards with jump consistent hashing.
+func newJumpHashKeyWrapper(count int, format Formatter) *hashKeyWrapper {
+	return newHashKeyWrapperWithPicker(count, format, jumpShard)
+}
+
+// newHashKeyWrapperWithPicker creates a new hashKeyWrapper instance with the
+// specified shard count, postfix format and hash-to-shard strategy.
+func newHashKeyWrapperWithPicker(count int, format Formatter, pick shardPicker) *hashKeyWrapper {
+	return newSnapshotHashKeyWrapper(newShardSnapshot(count, format), format, pick)
+}
+
+// newSnapshotHashKeyWrapper creates a new hashKeyWrapper like
+// newHashKeyWrapperWithPicker that starts with the given snapshot.
+func newSnapshotHashKeyWrapper(snap *shardSnapshot, format Formatter, pick shardPicker) *hashKeyWrapper {
+	w := &hashKeyWrapper{pick: pick, format: format}
+	w.resetSnapshot(snap)
+
+	return w
+}
+
+// ResetShardsCount updates the shard count for this wrapper.
+// Keys wrapped after this call are distributed over the new shard count.
+func (h *hashKeyWrapper) ResetShardsCount(count int) {
+	h.resetSnapshot(newShardSnapshot(count, h.format))
+}
+
+// resetSnapshot swaps in a snapshot built by the factory for all its wrappers.
+func (h *hashKeyWrapper) resetSnapshot(snap *shardSnapshot) {
+	h.snapshot.Store(snap)
+}
+
+// WrapKey wraps the given key with the postfix of the shard its hash maps to.
+// For single shard (shardsCount <= 1), it always appends ":1".
+// Example: "user:123" -> "user:123:2" on every call while the shard count stays the same.
+func (h *hashKeyWrapper) WrapKey(key string) string {
+	count := h.snapshot.Load().(*shardSnapshot).shardsCount
+
+	if count > 1 {
+		return h.format.wrap(key, h.pick(hashKey(key), count)+1)
+	}
+
+	return h.format.wrap(key, 1)
+}
+
+// hashKey returns the 64-bit FNV-1a hash of the key.
+// It is computed inline to avoid the allocations of hash/fnv.
+func hashKey(key string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= fnvPrime64
+	}
+
+	return h
+}
+
+// moduloShard picks the shard as the hash modulo the shard count.
+// Changing the shard count from N to N+1 moves almost every key.
+func moduloShard(hash uint64, count int) int {
+	return int(hash % uint64(count))
+}
+
+// jumpShard picks the shard with the jump consistent hash algorithm
+// (Lamping, Veach: "A Fast, Minimal Memory, Consistent Hash Algorithm").
+// Changing the shard count from N to N+1 moves only about 1/(N+1) of the keys,
+// all of them to the new shard.
+func jumpShard(hash uint64, count int) int {
+	var b, j int64 = -1, 0
+
+	for j < int64(count) {
+		b = j
+		hash = hash*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((hash>>33)+1)))
+	}
+
+	return int(b)
+}
@@ -0,0 +1,163 @@
+package key_wrapper
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHashKeyWrapper_WrapKey(t *testing.T) {
+	t.Run("shards count 0 or 1", func(t *testing.T) {
+		check := func(shardsCount int) {
+			kw := newHashKeyWrapper(shardsCount, Formatter{})
+
+			for i := 0; i < 100; i++ {
+				key := "key" + strconv.Itoa(i)
+				exp := key + ":1"
+
+				wrappedKey := kw.WrapKey(key)
+				if exp != wrappedKey {
+					t.Fatalf("got=%s != exp=%s", wrappedKey, exp)
+				}
+			}
+		}
+
+		check(0)
+		check(1)
+	})
+
+	t.Run("stable for the same key", func(t *testing.T) {
+		kw := newHashKeyWrapper(8, Formatter{})
+
+		exp := kw.WrapKey("user:123")
+		for i := 0; i < 100; i++ {
+			got := kw.WrapKey("user:123")
+			if got != exp {
+				t.Fatalf("got=%s != exp=%s", got, exp)
+			}
+		}
+	})
+
+	t.Run("uses every shard", func(t *testing.T) {
+		const shardsCount = 5
+
+		kw := newHashKeyWrapper(shardsCount, Formatter{})
+		seen := make(map[string]bool)
+
+		for i := 0; i < 1000; i++ {
+			key := "user:" + strconv.Itoa(i)
+			wrapped := kw.WrapKey(key)
+			seen[strings.TrimPrefix(wrapped, key)] = true
+		}
+
+		for i := 1; i <= shardsCount; i++ {
+			if !seen[":"+strconv.Itoa(i)] {
+				t.Fatalf("postfix :%d was never used", i)
+			}
+		}
+
+		if len(seen) != shardsCount {
+			t.Fatalf("expected %d postfixes, got %d", shardsCount, len(seen))
+		}
+	})
+}
+
+func TestFactory_MakeHashKeyWrapper(t *testing.T) {
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeHashKeyWrapper()
+
+	if got := w.WrapKey("user:123"); got != "user:123:1" {
+		t.Fatalf("got=%s, exp=user:123:1", got)
+	}
+
+	if err := f.compareAndUpdate(16); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	exp := newHashKeyWrapper(16, Formatter{}).WrapKey("user:123")
+	if got := w.WrapKey("user:123"); got != exp {
+		t.Fatalf("got=%s, exp=%s", got, exp)
+	}
+
+	if stats := f.Stats(); stats.GeneralWrappers != 1 {
+		t.Fatalf("expected 1 general wrapper, got %d", stats.GeneralWrappers)
+	}
+}
+
+func TestJumpShard(t *testing.T) {
+	t.Run("in range", func(t *testing.T) {
+		for count := 1; count <= 20; count++ {
+			for i := 0; i < 100; i++ {
+				shard := jumpShard(hashKey("key"+strconv.Itoa(i)), count)
+				if shard < 0 || shard >= count {
+					t.Fatalf("shard %d out of range [0, %d)", shard, count)
+				}
+			}
+		}
+	})
+
+	t.Run("minimal movement on grow", func(t *testing.T) {
+		const (
+			keysCount   = 10_000
+			shardsCount = 9
+		)
+
+		var moved int
+		for i := 0; i < keysCount; i++ {
+			hash := hashKey("user:" + strconv.Itoa(i))
+
+			before := jumpShard(hash, shardsCount)
+			after := jumpShard(hash, shardsCount+1)
+
+			if before == after {
+				continue
+			}
+
+			if after != shardsCount {
+				t.Fatalf("key moved from shard %d to old shard %d", before, after)
+			}
+
+			moved++
+		}
+
+		// about 1/(N+1) of the keys are expected to move
+		exp := keysCount / (shardsCount + 1)
+		if moved < exp/2 || moved > exp*3/2 {
+			t.Fatalf("moved %d keys, expected about %d", moved, exp)
+		}
+	})
+}
+
+func TestFactory_MakeJumpHashKeyWrapper(t *testing.T) {
+	f, err := NewFactory(4)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	general := f.MakeJumpHashKeyWrapper()
+	growing := f.MakeOnlyGrowingJumpHashKeyWrapper()
+
+	const key = "user:123"
+	expKey := newJumpHashKeyWrapper(4, Formatter{}).WrapKey(key)
+
+	if err := f.compareAndUpdate(1); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	if got := general.WrapKey(key); got != key+":1" {
+		t.Fatalf("got=%s, exp=%s", got, key+":1")
+	}
+
+	if got := growing.WrapKey(key); got != expKey {
+		t.Fatalf("got=%s, exp=%s", got, expKey)
+	}
+
+	stats := f.Stats()
+	if stats.GeneralWrappers != 1 || stats.GrowingWrappers != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,88 @@
+package key_wrapper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HighWaterStore persists the highest shard count a factory has ever applied,
+// so that after a restart with a lower shard count readers still cover
+// the shards only-growing wrappers may have written to.
+type HighWaterStore interface {
+	// Load returns the stored high-water mark, or 0 if nothing is stored yet.
+	Load() (int, error)
+	// Save stores the high-water mark.
+	Save(count int) error
+}
+
+// Compile-time interface compliance checks
+var _ HighWaterStore = (*FileHighWaterStore)(nil)
+
+// FileHighWaterStore is a HighWaterStore that keeps the high-water mark
+// in a local file as a decimal number.
+type FileHighWaterStore struct {
+	path string // path of the file holding the high-water mark
+}
+
+// NewFileHighWaterStore creates a new FileHighWaterStore that keeps
+// the high-water mark in the file at path. The file is created on the first Save.
+func NewFileHighWaterStore(path string) *FileHighWaterStore {
+	return &FileHighWaterStore{path: path}
+}
+
+// Load reads the high-water mark from the file.
+// It returns 0 if the file does not exist.
+func (s *FileHighWaterStore) Load() (int, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("read high-water file: %w", err)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parse high-water file %s: %w", s.path, err)
+	}
+
+	return count, nil
+}
+
+// Save writes the high-water mark to the file.
+// The new value is synced to disk before the file is replaced atomically,
+// so a crash or power loss leaves either the old or the new value behind,
+// never a partial or empty one.
+func (s *FileHighWaterStore) Save(count int) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("create high-water temp file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.WriteString(strconv.Itoa(count) + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write high-water temp file: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync high-water temp file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close high-water temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replace high-water file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package key_wrapper
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileHighWaterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "high-water")
+	s := NewFileHighWaterStore(path)
+
+	count, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if count != 0 {
+		t.Fatalf("expected 0 for a missing file, got %d", count)
+	}
+
+	if err := s.Save(12); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	count, err = s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if count != 12 {
+		t.Fatalf("expected 12, got %d", count)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("twelve"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := s.Load(); err == nil {
+		t.Fatal("expected error for a malformed file, got nil")
+	}
+}
+
+func TestFactory_HighWater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "high-water")
+
+	f, err := NewFactory(3, WithHighWaterStore(NewFileHighWaterStore(path)))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	if err := f.compareAndUpdate(6); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	if err := f.compareAndUpdate(2); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	if stats := f.Stats(); stats.HighWaterShards != 6 {
+		t.Fatalf("expected high-water mark 6, got %d", stats.HighWaterShards)
+	}
+
+	// a restarted factory with a lower count restores the mark
+	restarted, err := NewFactory(2, WithHighWaterStore(NewFileHighWaterStore(path)))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	if stats := restarted.Stats(); stats.Shards != 2 || stats.HighWaterShards != 6 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if got := len(restarted.AllOnlyGrowingKeys("key")); got != 6 {
+		t.Fatalf("expected 6 only-growing keys, got %d", got)
+	}
+}
+
+// flakyHighWaterStore is an in-memory HighWaterStore whose saves fail
+// while failing is set.
+type flakyHighWaterStore struct {
+	saved   int
+	failing bool
+}
+
+func (s *flakyHighWaterStore) Load() (int, error) { return s.saved, nil }
+
+func (s *flakyHighWaterStore) Save(count int) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+
+	s.saved = count
+
+	return nil
+}
+
+func TestFactory_HighWaterSaveRetry(t *testing.T) {
+	store := &flakyHighWaterStore{}
+
+	f, err := NewFactory(2, WithHighWaterStore(store))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	store.failing = true
+
+	if err := f.compareAndUpdate(5); err == nil {
+		t.Fatal("expected save error, got nil")
+	}
+
+	// the shard count is applied even though the mark was not persisted
+	if stats := f.Stats(); stats.Shards != 5 || stats.HighWaterShards != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	store.failing = false
+
+	if err := f.compareAndUpdate(3); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	if store.saved != 5 {
+		t.Fatalf("got=%d persisted, exp=5", store.saved)
+	}
+
+	// a persisted mark is not saved again
+	store.failing = true
+
+	if err := f.compareAndUpdate(4); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+}
+
+type failingHighWaterStore struct{}
+
+func (failingHighWaterStore) Load() (int, error) { return 0, errors.New("unavailable") }
+func (failingHighWaterStore) Save(int) error     { return errors.New("unavailable") }
+
+func TestWithHighWaterStore(t *testing.T) {
+	if _, err := NewFactory(1, WithHighWaterStore(nil)); err == nil {
+		t.Fatal("expected error for nil store, got nil")
+	}
+
+	if _, err := NewFactory(1, WithHighWaterStore(failingHighWaterStore{})); err == nil {
+		t.Fatal("expected error for failing store, got nil")
+	}
+}
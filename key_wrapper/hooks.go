@@ -0,0 +1,80 @@
+package key_wrapper
+
+import (
+	"fmt"
+)
+
+// ShardTransition is a proposed shard count change passed to shard change hooks.
+type ShardTransition struct {
+	OldShards int // shard count currently applied to the wrappers
+	NewShards int // proposed shard count
+}
+
+// ShardChangeHook is called before a shard count change is applied and can
+// reject it by returning a non-nil error that explains the reason, e.g. to
+// block a reduction while a migration job is running.
+//
+// Hooks are called with the factory lock held, so they must be fast
+// and must not call methods of the factory.
+type ShardChangeHook func(t ShardTransition) error
+
+// ShardChangeRejectedError is returned when a shard change hook rejects
+// a shard count change. The Interrogator passes it to Config.ErrorHandler.
+type ShardChangeRejectedError struct {
+	ShardTransition
+	Reason error // error returned by the rejecting hook
+}
+
+func (e *ShardChangeRejectedError) Error() string {
+	return fmt.Sprintf("shard count change from %d to %d rejected: %v",
+		e.OldShards, e.NewShards, e.Reason)
+}
+
+func (e *ShardChangeRejectedError) Unwrap() error {
+	return e.Reason
+}
+
+// shardChangeHook is a registered hook; a pointer identifies it for removal.
+type shardChangeHook struct {
+	fn ShardChangeHook
+}
+
+// AddShardChangeHook registers a hook that is called before every shard count
+// change, both when a change is applied directly and when it is prepared or
+// committed in a two-phase change. Hooks are called in registration order and
+// the first rejection stops the change; the Interrogator retries it on its next
+// check, so a hook may approve it later. It returns a function that removes the hook.
+func (f *Factory) AddShardChangeHook(hook ShardChangeHook) func() {
+	h := &shardChangeHook{fn: hook}
+
+	f.mu.Lock()
+	f.shardChangeHooks = append(f.shardChangeHooks, h)
+	f.mu.Unlock()
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		for i, registered := range f.shardChangeHooks {
+			if registered == h {
+				f.shardChangeHooks = append(f.shardChangeHooks[:i], f.shardChangeHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// approveShardChange asks all hooks whether the shard count may change to
+// shardCount and records a rejection. The caller must hold f.mu.
+func (f *Factory) approveShardChange(shardCount int) error {
+	t := ShardTransition{OldShards: f.shardsCount, NewShards: shardCount}
+
+	for _, h := range f.shardChangeHooks {
+		if err := h.fn(t); err != nil {
+			f.rejectedShardChanges++
+			return &ShardChangeRejectedError{ShardTransition: t, Reason: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package key_wrapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFactory_ShardChangeHooks(t *testing.T) {
+	errMigration := errors.New("migration job is running")
+
+	t.Run("rejects a reduction", func(t *testing.T) {
+		f, err := NewFactory(4)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		w := f.MakeKeyWrapper()
+
+		remove := f.AddShardChangeHook(func(t ShardTransition) error {
+			if t.NewShards < t.OldShards {
+				return errMigration
+			}
+
+			return nil
+		})
+
+		err = f.compareAndUpdate(2)
+
+		var rejected *ShardChangeRejectedError
+		if !errors.As(err, &rejected) {
+			t.Fatalf("expected *ShardChangeRejectedError, got %v", err)
+		}
+
+		if rejected.OldShards != 4 || rejected.NewShards != 2 || !errors.Is(err, errMigration) {
+			t.Fatalf("unexpected rejection: %v", rejected)
+		}
+
+		stats := f.Stats()
+		if stats.Shards != 4 || stats.RejectedShardChanges != 1 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+
+		for _, exp := range []string{"key:1", "key:2", "key:3", "key:4"} {
+			if got := w.WrapKey("key"); got != exp {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		}
+
+		// growing is approved
+		if err := f.compareAndUpdate(5); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		remove()
+
+		if err := f.compareAndUpdate(2); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+	})
+
+	t.Run("first rejection stops the change", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		var calls []string
+		f.AddShardChangeHook(func(ShardTransition) error {
+			calls = append(calls, "first")
+			return errMigration
+		})
+		f.AddShardChangeHook(func(ShardTransition) error {
+			calls = append(calls, "second")
+			return nil
+		})
+
+		if err := f.compareAndUpdate(2); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		if len(calls) != 1 || calls[0] != "first" {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+	})
+
+	t.Run("two-phase change", func(t *testing.T) {
+		f, err := NewFactory(2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		approve := false
+		f.AddShardChangeHook(func(ShardTransition) error {
+			if !approve {
+				return errMigration
+			}
+
+			return nil
+		})
+
+		if _, err := f.prepareUpdate(3); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		if got := f.Stats().PendingShards; got != 0 {
+			t.Fatalf("got=%d pending shards, exp=0", got)
+		}
+
+		approve = true
+
+		prepared, err := f.prepareUpdate(3)
+		if err != nil || !prepared {
+			t.Fatalf("prepareUpdate: %v, prepared=%v", err, prepared)
+		}
+
+		// the hook is asked again on commit
+		approve = false
+
+		if err := f.CommitPending(); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		if stats := f.Stats(); stats.Shards != 2 || stats.RejectedShardChanges != 2 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("rejection reaches ErrorHandler", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		f.AddShardChangeHook(func(t ShardTransition) error {
+			if t.NewShards > 64 {
+				return errors.New("scaling past 64 shards requires approval")
+			}
+
+			return nil
+		})
+
+		var handled error
+		cfg := &Config{
+			GetShardsCount: func() (int, error) { return 65, nil },
+			Factory:        f,
+			ErrorHandler:   func(err error) { handled = err },
+		}
+
+		(&Interrogator{}).checkAndUpdate(context.Background(), cfg)
+
+		var rejected *ShardChangeRejectedError
+		if !errors.As(handled, &rejected) || rejected.NewShards != 65 {
+			t.Fatalf("expected *ShardChangeRejectedError, got %v", handled)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package key_wrapper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,11 @@ import (
 type Interrogator struct {
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
+
+	ctx     context.Context // canceled when the interrogator stops
+	cfg     *Config
+	checkMu sync.Mutex // serializes checks, commits and pausing
+	paused  bool       // guarded by checkMu
 }
 
 // RunInterrogator starts a new interrogator with the given configuration.
@@ -27,6 +33,8 @@ func RunInterrogator(cfg *Config) (*Interrogator, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	srv := &Interrogator{
 		cancel: cancel,
+		ctx:    ctx,
+		cfg:    cfg,
 	}
 
 	srv.wg.Add(1)
@@ -73,38 +81,351 @@ func (l *Interrogator) StopWithContext(ctx context.Context) error {
 	}
 }
 
+// Refresh runs a check right away instead of waiting for the next interval
+// and returns the resulting shard count of the factory. A pending shard count,
+// prepared by this check or an earlier one, is committed immediately,
+// regardless of Config.CommitDelay.
+// Errors from the sources or the factory update are returned instead of being
+// passed to the ErrorHandler; if several occur, the first one is returned.
+// The context bounds the source calls in addition to Config.SourceTimeout,
+// and stopping the interrogator cancels them as well.
+// Refresh fails if the interrogator is stopped or paused.
+func (l *Interrogator) Refresh(ctx context.Context) (int, error) {
+	l.checkMu.Lock()
+	defer l.checkMu.Unlock()
+
+	if l.ctx == nil || l.ctx.Err() != nil {
+		return 0, errors.New("interrogator is stopped")
+	}
+
+	if l.paused {
+		return 0, errors.New("interrogator is paused")
+	}
+
+	var firstErr error
+
+	cfg := *l.cfg
+	cfg.ErrorHandler = func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	ctx, cancel := l.withStop(ctx)
+	defer cancel()
+
+	_, failed := l.checkAndUpdate(ctx, &cfg)
+	if failed && firstErr == nil {
+		// the source was aborted because the interrogator stops
+		return 0, errors.New("interrogator is stopped")
+	}
+
+	// commit the pending count, whether this check or an earlier one prepared it
+	if cfg.CommitDelay > 0 {
+		if err := cfg.Factory.CommitPending(); err != nil {
+			cfg.ErrorHandler(err)
+		}
+	}
+
+	if firstErr != nil {
+		return 0, firstErr
+	}
+
+	return cfg.Factory.Stats().Shards, nil
+}
+
+// Pause freezes shard updates until Resume is called, e.g. during
+// a maintenance window. Checks that fall due while paused are skipped and
+// a prepared shard count is committed only after Resume. Pause waits for
+// a check in progress, so no update is applied once it returns.
+// Calling Pause on a paused interrogator has no effect.
+func (l *Interrogator) Pause() {
+	l.checkMu.Lock()
+	defer l.checkMu.Unlock()
+
+	l.paused = true
+}
+
+// Resume continues shard updates frozen by Pause, starting with the next
+// scheduled check. Calling Resume on a running interrogator has no effect.
+func (l *Interrogator) Resume() {
+	l.checkMu.Lock()
+	defer l.checkMu.Unlock()
+
+	l.paused = false
+}
+
+// Paused reports whether shard updates are frozen by Pause.
+func (l *Interrogator) Paused() bool {
+	l.checkMu.Lock()
+	defer l.checkMu.Unlock()
+
+	return l.paused
+}
+
 // run is the main loop of the interrogator that runs in a separate goroutine.
-// It periodically checks for shard count changes using the configured interval
-// and stops when the context is canceled.
+// It periodically checks for shard count changes using the configured interval,
+// starting with an immediate check if Config.PollOnStart is set,
+// backs off while source functions fail, and stops when the context is canceled.
+// With a commit delay configured, it also commits prepared shard counts once
+// the delay has passed. While paused, checks are skipped and commits are
+// postponed.
 func (l *Interrogator) run(ctx context.Context, cfg *Config) {
 	defer l.wg.Done()
 
-	t := time.NewTicker(cfg.Interval)
+	clock := cfg.clock()
+	schedule := newPollSchedule(cfg)
+
+	delay := schedule.next(false)
+	if cfg.PollOnStart {
+		delay = 0
+	}
+
+	t := clock.NewTimer(delay)
 	defer t.Stop()
 
+	var (
+		commitTimer Timer
+		commitC     <-chan time.Time
+	)
+
+	defer func() {
+		if commitTimer != nil {
+			commitTimer.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-t.C:
-			l.checkAndUpdate(cfg)
+		case <-t.C():
+			l.checkMu.Lock()
+
+			var prepared, failed bool
+			if !l.paused {
+				prepared, failed = l.checkAndUpdate(ctx, cfg)
+			}
+
+			l.checkMu.Unlock()
+
+			t.Reset(schedule.next(failed))
+
+			if !prepared {
+				continue
+			}
+
+			if commitTimer != nil {
+				commitTimer.Stop()
+			}
+
+			commitTimer = clock.NewTimer(cfg.CommitDelay)
+			commitC = commitTimer.C()
+		case <-commitC:
+			l.checkMu.Lock()
+
+			if l.paused {
+				// retry once the interrogator is resumed
+				commitTimer.Reset(cfg.CommitDelay)
+			} else {
+				commitC = nil
+
+				if err := cfg.Factory.CommitPending(); err != nil {
+					cfg.ErrorHandler(err)
+				}
+			}
+
+			l.checkMu.Unlock()
 		}
 	}
 }
 
-// checkAndUpdate performs a single check for shard count changes.
-// It calls the configured GetShardsCount function and updates the factory if needed.
-// Any errors from GetShardsCount or factory update are passed to the ErrorHandler.
-func (l *Interrogator) checkAndUpdate(cfg *Config) {
-	count, err := cfg.GetShardsCount()
+// checkAndUpdate performs a single check for shard count, shard ID, shard weight,
+// slot table, slot migration and Redis Cluster slot map changes.
+// It calls the configured source functions and updates the factory if needed.
+// Any errors from the sources or factory update are passed to the ErrorHandler.
+// It reports whether a new shard count was prepared and needs to be committed
+// after Config.CommitDelay, and whether any source function failed.
+func (l *Interrogator) checkAndUpdate(ctx context.Context, cfg *Config) (prepared, failed bool) {
+	if source := cfg.shardsCountSource(); source != nil {
+		var countFailed bool
+		prepared, countFailed = l.checkAndUpdateCount(ctx, cfg, source)
+		failed = failed || countFailed
+	}
+
+	if cfg.GetShardIDs != nil {
+		failed = l.checkAndUpdateIDs(cfg) || failed
+	}
+
+	if cfg.GetShardWeights != nil {
+		failed = l.checkAndUpdateWeights(cfg) || failed
+	}
+
+	if cfg.GetSlotTable != nil {
+		failed = l.checkAndUpdateSlotTable(cfg) || failed
+	}
+
+	if cfg.GetSlotMigrations != nil {
+		failed = l.checkAndUpdateSlotMigrations(cfg) || failed
+	}
+
+	if cfg.GetClusterSlots != nil {
+		failed = l.checkAndUpdateClusterSlots(cfg) || failed
+	}
+
+	return prepared, failed
+}
+
+// checkAndUpdateCount applies the shard count returned by the shard count source.
+// With Config.CommitDelay set, a changed count is only prepared and
+// checkAndUpdateCount reports whether it needs to be committed later.
+// It also reports whether the source failed. A source aborted because
+// the interrogator stops is not reported to the ErrorHandler.
+func (l *Interrogator) checkAndUpdateCount(
+	ctx context.Context, cfg *Config, source ShardsCountSource,
+) (prepared, failed bool) {
+	count, err := fetchShardsCount(ctx, source, cfg.SourceTimeout)
 	if err != nil {
-		cfg.ErrorHandler(err)
-		return
+		if !l.stopped() {
+			cfg.ErrorHandler(err)
+		}
+
+		return false, true
+	}
+
+	if cfg.CommitDelay > 0 {
+		prepared, err := cfg.Factory.prepareUpdate(count)
+		if err != nil {
+			cfg.ErrorHandler(err)
+			return false, false
+		}
+
+		return prepared, false
 	}
 
 	err = cfg.Factory.compareAndUpdate(count)
 	if err != nil {
 		cfg.ErrorHandler(err)
-		return
+		return false, false
 	}
+
+	return false, false
+}
+
+// stopped reports whether the interrogator is stopped.
+func (l *Interrogator) stopped() bool {
+	return l.ctx != nil && l.ctx.Err() != nil
+}
+
+// withStop returns a copy of ctx that is also canceled when the interrogator
+// stops. The returned cancel function must be called to release the context.
+func (l *Interrogator) withStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-l.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// checkAndUpdateIDs applies the shard IDs returned by GetShardIDs.
+// It reports whether GetShardIDs failed.
+func (l *Interrogator) checkAndUpdateIDs(cfg *Config) bool {
+	ids, err := cfg.GetShardIDs()
+	if err != nil {
+		cfg.ErrorHandler(err)
+		return true
+	}
+
+	err = cfg.Factory.compareAndUpdateShardIDs(ids)
+	if err != nil {
+		cfg.ErrorHandler(err)
+	}
+
+	return false
+}
+
+// checkAndUpdateWeights applies the shard weights returned by GetShardWeights.
+// It reports whether GetShardWeights failed.
+func (l *Interrogator) checkAndUpdateWeights(cfg *Config) bool {
+	weights, err := cfg.GetShardWeights()
+	if err != nil {
+		cfg.ErrorHandler(err)
+		return true
+	}
+
+	err = cfg.Factory.compareAndUpdateShardWeights(weights)
+	if err != nil {
+		cfg.ErrorHandler(err)
+	}
+
+	return false
+}
+
+// checkAndUpdateSlotTable applies the slot table returned by GetSlotTable.
+// It reports whether GetSlotTable failed.
+func (l *Interrogator) checkAndUpdateSlotTable(cfg *Config) bool {
+	table, err := cfg.GetSlotTable()
+	if err != nil {
+		cfg.ErrorHandler(err)
+		return true
+	}
+
+	err = cfg.Factory.compareAndUpdateSlotTable(table)
+	if err != nil {
+		cfg.ErrorHandler(err)
+	}
+
+	return false
+}
+
+// checkAndUpdateSlotMigrations applies the slot migrations returned by GetSlotMigrations.
+// It reports whether GetSlotMigrations failed.
+func (l *Interrogator) checkAndUpdateSlotMigrations(cfg *Config) bool {
+	migrations, err := cfg.GetSlotMigrations()
+	if err != nil {
+		cfg.ErrorHandler(err)
+		return true
+	}
+
+	err = cfg.Factory.compareAndUpdateSlotMigrations(migrations)
+	if err != nil {
+		cfg.ErrorHandler(err)
+	}
+
+	return false
+}
+
+// checkAndUpdateClusterSlots applies the Redis Cluster slot map returned by GetClusterSlots.
+// It reports whether GetClusterSlots failed.
+func (l *Interrogator) checkAndUpdateClusterSlots(cfg *Config) bool {
+	ranges, err := cfg.GetClusterSlots()
+	if err != nil {
+		cfg.ErrorHandler(err)
+		return true
+	}
+
+	err = cfg.Factory.compareAndUpdateClusterSlots(ranges)
+	if err != nil {
+		cfg.ErrorHandler(err)
+	}
+
+	return false
+}
+
+// fetchShardsCount calls the source with a context bounded by timeout,
+// if the timeout is greater than zero.
+func fetchShardsCount(ctx context.Context, source ShardsCountSource, timeout time.Duration) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return source.ShardsCount(ctx)
 }
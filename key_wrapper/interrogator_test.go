@@ -0,0 +1,579 @@
+package key_wrapper_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/releaseband/wrappers/v2/key_wrapper"
+	"github.com/releaseband/wrappers/v2/key_wrapper/clocktest"
+)
+
+// start is the initial time of the fake clocks in the tests.
+var start = time.Unix(1000, 0)
+
+func TestInterrogator_Interval(t *testing.T) {
+	const interval = 10 * time.Second
+
+	factory, err := key_wrapper.NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	clock := clocktest.NewFakeClock(start)
+	checks := make(chan time.Time, 10)
+
+	srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+		GetShardsCount: func() (int, error) {
+			checks <- clock.Now()
+			return 3, nil
+		},
+		Factory:      factory,
+		Interval:     interval,
+		Clock:        clock,
+		ErrorHandler: func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to run interrogator: %v", err)
+	}
+	defer srv.Stop()
+
+	clock.BlockUntil(1)
+	clock.Advance(interval - time.Nanosecond)
+
+	if got := factory.Stats().Shards; got != 1 {
+		t.Fatalf("got=%d shards before the interval, exp=1", got)
+	}
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Nanosecond)
+
+		if got, exp := <-checks, start.Add(time.Duration(i)*interval); !got.Equal(exp) {
+			t.Fatalf("check %d: got=%s, exp=%s", i, got, exp)
+		}
+
+		// the check is done once the next one is scheduled
+		clock.BlockUntil(1)
+
+		if got := factory.Stats().Shards; got != 3 {
+			t.Fatalf("got=%d shards, exp=3", got)
+		}
+
+		clock.Advance(interval - time.Nanosecond)
+	}
+
+	select {
+	case got := <-checks:
+		t.Fatalf("unexpected check at %s", got)
+	default:
+	}
+}
+
+func TestInterrogator_CommitDelay(t *testing.T) {
+	const (
+		interval    = 10 * time.Second
+		commitDelay = 3 * time.Second
+	)
+
+	// the interrogator uses the clock of the factory
+	clock := clocktest.NewFakeClock(start)
+
+	factory, err := key_wrapper.NewFactory(1, key_wrapper.WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	events, cancel := factory.Subscribe(1)
+	defer cancel()
+
+	srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+		GetShardsCount: func() (int, error) { return 2, nil },
+		Factory:        factory,
+		Interval:       interval,
+		CommitDelay:    commitDelay,
+		ErrorHandler:   func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to run interrogator: %v", err)
+	}
+	defer srv.Stop()
+
+	clock.BlockUntil(1)
+	clock.Advance(interval)
+
+	// the next check and the commit are scheduled
+	clock.BlockUntil(2)
+
+	if stats := factory.Stats(); stats.Shards != 1 || stats.PendingShards != 2 {
+		t.Fatalf("unexpected stats after prepare: %+v", stats)
+	}
+
+	clock.Advance(commitDelay)
+
+	ev := <-events
+	if ev.OldShards != 1 || ev.NewShards != 2 {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	if got, exp := ev.Time, start.Add(interval+commitDelay); !got.Equal(exp) {
+		t.Fatalf("committed at %s, exp=%s", got, exp)
+	}
+}
+
+func TestInterrogator_Backoff(t *testing.T) {
+	const (
+		interval   = time.Second
+		maxBackoff = 4 * time.Second
+	)
+
+	factory, err := key_wrapper.NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	clock := clocktest.NewFakeClock(start)
+	checks := make(chan time.Time, 10)
+	errSource := errors.New("source is down")
+
+	srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+		GetShardsCount: func() (int, error) {
+			checks <- clock.Now()
+			return 0, errSource
+		},
+		Factory:      factory,
+		Interval:     interval,
+		MaxBackoff:   maxBackoff,
+		Clock:        clock,
+		ErrorHandler: func(err error) {},
+	})
+	if err != nil {
+		t.Fatalf("failed to run interrogator: %v", err)
+	}
+	defer srv.Stop()
+
+	clock.BlockUntil(1)
+	clock.Advance(interval)
+	<-checks
+
+	// with full jitter every check happens at the latest after
+	// the capped backoff, and exactly one check happens per step
+	for i := 0; i < 5; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(maxBackoff)
+
+		<-checks
+
+		select {
+		case got := <-checks:
+			t.Fatalf("unexpected second check at %s", got)
+		default:
+		}
+	}
+}
+
+func TestInterrogator_Stop(t *testing.T) {
+	factory, err := key_wrapper.NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	clock := clocktest.NewFakeClock(start)
+
+	srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+		GetShardsCount: func() (int, error) { return 1, nil },
+		Factory:        factory,
+		Interval:       time.Second,
+		Clock:          clock,
+		ErrorHandler:   func(err error) {},
+	})
+	if err != nil {
+		t.Fatalf("failed to run interrogator: %v", err)
+	}
+
+	clock.BlockUntil(1)
+	srv.Stop()
+
+	if got := clock.ActiveTimers(); got != 0 {
+		t.Fatalf("got=%d active timers after Stop, exp=0", got)
+	}
+}
+
+func TestInterrogator_StopCancelsSource(t *testing.T) {
+	factory, err := key_wrapper.NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	clock := clocktest.NewFakeClock(start)
+	called := make(chan struct{})
+
+	srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+		ShardsCountSource: key_wrapper.ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+			close(called)
+			<-ctx.Done() // a hung call that honors the context
+			return 0, ctx.Err()
+		}),
+		Factory:      factory,
+		Interval:     time.Second,
+		Clock:        clock,
+		ErrorHandler: func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to run interrogator: %v", err)
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-called
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := srv.StopWithContext(ctx); err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+}
+
+func TestInterrogator_PollOnStart(t *testing.T) {
+	const interval = 10 * time.Second
+
+	factory, err := key_wrapper.NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	clock := clocktest.NewFakeClock(start)
+	checks := make(chan time.Time, 10)
+
+	srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+		GetShardsCount: func() (int, error) {
+			checks <- clock.Now()
+			return 3, nil
+		},
+		Factory:      factory,
+		Interval:     interval,
+		PollOnStart:  true,
+		Clock:        clock,
+		ErrorHandler: func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to run interrogator: %v", err)
+	}
+	defer srv.Stop()
+
+	if got := <-checks; !got.Equal(start) {
+		t.Fatalf("got=%s, exp=%s", got, start)
+	}
+
+	clock.BlockUntil(1)
+
+	if got := factory.Stats().Shards; got != 3 {
+		t.Fatalf("got=%d shards, exp=3", got)
+	}
+
+	clock.Advance(interval)
+
+	if got, exp := <-checks, start.Add(interval); !got.Equal(exp) {
+		t.Fatalf("got=%s, exp=%s", got, exp)
+	}
+}
+
+func TestInterrogator_Refresh(t *testing.T) {
+	const interval = 10 * time.Second
+
+	t.Run("applies the count now", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			GetShardsCount: func() (int, error) { return 4, nil },
+			Factory:        factory,
+			Interval:       interval,
+			CommitDelay:    time.Minute,
+			Clock:          clocktest.NewFakeClock(start),
+			ErrorHandler:   func(err error) { t.Errorf("unexpected error: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+		defer srv.Stop()
+
+		count, err := srv.Refresh(context.Background())
+		if err != nil {
+			t.Fatalf("failed to refresh: %v", err)
+		}
+
+		if count != 4 {
+			t.Fatalf("got=%d, exp=4", count)
+		}
+
+		// the commit delay is skipped
+		if stats := factory.Stats(); stats.Shards != 4 || stats.PendingShards != 0 {
+			t.Fatalf("unexpected stats after refresh: %+v", stats)
+		}
+	})
+
+	t.Run("commits a count prepared earlier", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		clock := clocktest.NewFakeClock(start)
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			GetShardsCount: func() (int, error) { return 5, nil },
+			Factory:        factory,
+			Interval:       interval,
+			CommitDelay:    time.Minute,
+			Clock:          clock,
+			ErrorHandler:   func(err error) { t.Errorf("unexpected error: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+		defer srv.Stop()
+
+		clock.BlockUntil(1)
+		clock.Advance(interval)
+		clock.BlockUntil(2) // the next check and the commit are scheduled
+
+		if got := factory.Stats().PendingShards; got != 5 {
+			t.Fatalf("got=%d pending shards, exp=5", got)
+		}
+
+		count, err := srv.Refresh(context.Background())
+		if err != nil {
+			t.Fatalf("failed to refresh: %v", err)
+		}
+
+		if count != 5 {
+			t.Fatalf("got=%d, exp=5", count)
+		}
+
+		if stats := factory.Stats(); stats.Shards != 5 || stats.PendingShards != 0 {
+			t.Fatalf("unexpected stats after refresh: %+v", stats)
+		}
+	})
+
+	t.Run("returns errors", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		errSource := errors.New("source is down")
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			GetShardsCount: func() (int, error) { return 0, errSource },
+			Factory:        factory,
+			Interval:       interval,
+			Clock:          clocktest.NewFakeClock(start),
+			ErrorHandler:   func(err error) { t.Errorf("unexpected error handled: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+
+		if _, err := srv.Refresh(context.Background()); !errors.Is(err, errSource) {
+			t.Fatalf("got=%v, exp=%v", err, errSource)
+		}
+
+		srv.Stop()
+
+		if _, err := srv.Refresh(context.Background()); err == nil {
+			t.Fatal("expected error after Stop, got nil")
+		}
+	})
+
+	t.Run("returns source timeouts", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			ShardsCountSource: key_wrapper.ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}),
+			Factory:      factory,
+			Interval:     interval,
+			Clock:        clocktest.NewFakeClock(start),
+			ErrorHandler: func(err error) { t.Errorf("unexpected error handled: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+		defer srv.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := srv.Refresh(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got=%v, exp=%v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("canceled on stop", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		called := make(chan struct{})
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			ShardsCountSource: key_wrapper.ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+				close(called)
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}),
+			Factory:      factory,
+			Interval:     interval,
+			Clock:        clocktest.NewFakeClock(start),
+			ErrorHandler: func(err error) { t.Errorf("unexpected error handled: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := srv.Refresh(context.Background())
+			errs <- err
+		}()
+
+		<-called
+		srv.Stop()
+
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Fatal("expected error after Stop, got nil")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Refresh did not return after Stop")
+		}
+	})
+}
+
+func TestInterrogator_Pause(t *testing.T) {
+	const (
+		interval    = 10 * time.Second
+		commitDelay = 3 * time.Second
+	)
+
+	t.Run("skips checks", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		clock := clocktest.NewFakeClock(start)
+		checks := make(chan time.Time, 10)
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			GetShardsCount: func() (int, error) {
+				checks <- clock.Now()
+				return 2, nil
+			},
+			Factory:      factory,
+			Interval:     interval,
+			Clock:        clock,
+			ErrorHandler: func(err error) { t.Errorf("unexpected error: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+		defer srv.Stop()
+
+		srv.Pause()
+
+		if !srv.Paused() {
+			t.Fatal("expected paused interrogator")
+		}
+
+		for i := 0; i < 3; i++ {
+			clock.BlockUntil(1)
+			clock.Advance(interval)
+		}
+
+		clock.BlockUntil(1)
+
+		select {
+		case got := <-checks:
+			t.Fatalf("unexpected check at %s", got)
+		default:
+		}
+
+		if _, err := srv.Refresh(context.Background()); err == nil {
+			t.Fatal("expected error while paused, got nil")
+		}
+
+		if got := factory.Stats().Shards; got != 1 {
+			t.Fatalf("got=%d shards while paused, exp=1", got)
+		}
+
+		srv.Resume()
+		clock.Advance(interval)
+
+		if got, exp := <-checks, start.Add(4*interval); !got.Equal(exp) {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+
+		clock.BlockUntil(1)
+
+		if got := factory.Stats().Shards; got != 2 {
+			t.Fatalf("got=%d shards after resume, exp=2", got)
+		}
+	})
+
+	t.Run("postpones commits", func(t *testing.T) {
+		factory, err := key_wrapper.NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := factory.Subscribe(1)
+		defer cancel()
+
+		clock := clocktest.NewFakeClock(start)
+
+		srv, err := key_wrapper.RunInterrogator(&key_wrapper.Config{
+			GetShardsCount: func() (int, error) { return 2, nil },
+			Factory:        factory,
+			Interval:       interval,
+			CommitDelay:    commitDelay,
+			Clock:          clock,
+			ErrorHandler:   func(err error) { t.Errorf("unexpected error: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to run interrogator: %v", err)
+		}
+		defer srv.Stop()
+
+		clock.BlockUntil(1)
+		clock.Advance(interval)
+		clock.BlockUntil(2) // the next check and the commit are scheduled
+
+		srv.Pause()
+		clock.Advance(commitDelay)
+		clock.BlockUntil(2) // the commit is scheduled again
+
+		if stats := factory.Stats(); stats.Shards != 1 || stats.PendingShards != 2 {
+			t.Fatalf("unexpected stats while paused: %+v", stats)
+		}
+
+		srv.Resume()
+		clock.Advance(commitDelay)
+
+		ev := <-events
+		if ev.OldShards != 1 || ev.NewShards != 2 {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	})
+}
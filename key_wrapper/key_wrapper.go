@@ -1,12 +1,9 @@
 package key_wrapper
 
 import (
-	"strconv"
+	"context"
 	"sync"
-)
-
-const (
-	defaultPostfix = ":1"
+	"sync/atomic"
 )
 
 // KeyWrapper provides functionality to wrap keys with shard postfixes.
@@ -30,24 +27,96 @@ type WrapperFactory interface {
 	Stats() FactoryStats
 }
 
+// AppendKeyWrapper is a KeyWrapper that can append wrapped keys to a byte
+// buffer without allocating. The wrappers returned by MakeKeyWrapper and
+// MakeOnlyGrowingKeyWrapper implement AppendKeyWrapper.
+type AppendKeyWrapper interface {
+	KeyWrapper
+	// AppendWrappedKey appends the wrapped key to dst and returns the extended buffer.
+	AppendWrappedKey(dst []byte, key string) []byte
+}
+
 // Compile-time interface compliance checks
 var _ KeyWrapper = (*keyWrapper)(nil)
+var _ AppendKeyWrapper = (*keyWrapper)(nil)
 var _ WrapperFactory = (*Factory)(nil)
 
 // keyWrapper is the concrete implementation of KeyWrapper interface.
 // It maintains an internal counter (i) and current shard count to generate
 // cyclic postfixes for even key distribution across shards.
+//
+// keyWrapper is lock-free: the counter is advanced with compare-and-swap and
+// the shard count lives in an immutable snapshot that is swapped atomically.
+// The factory builds one snapshot per shard count change and stores the same
+// pointer into all its wrappers, so a change is a single pointer swap per wrapper.
 type keyWrapper struct {
-	mu          sync.Mutex // protects i and shardsCount from concurrent access
-	i           int        // current position in the cycle (1 to shardsCount)
-	shardsCount int        // total number of shards for distribution
+	i          int64           // current position in the cycle (1 to shardsCount), accessed atomically
+	snapshot   atomic.Value    // current *shardSnapshot, replaced on shard count changes
+	stripes    []counterStripe // per-processor counters in striped mode, nil otherwise
+	stripeIDs  sync.Pool       // hands out *int stripe indexes with processor affinity
+	nextStripe uint32          // stripe index assigned to the next new pool entry
+	format     Formatter       // renders shard postfixes
+}
+
+// counterStripe is a cycle position of a striped keyWrapper,
+// padded to a cache line so stripes do not share one.
+type counterStripe struct {
+	i int64
+	_ [56]byte
+}
+
+// shardSnapshot is an immutable shard configuration of keyWrapper and
+// hashKeyWrapper. It is never modified once created, so one snapshot can be
+// shared by all wrappers of a factory.
+type shardSnapshot struct {
+	shardsCount int      // total number of shards for distribution
+	postfixes   []string // precomputed postfixes of shards 1..shardsCount, at least one
+}
+
+// newShardSnapshot creates a snapshot for the shard count with the postfixes
+// rendered in the given format.
+func newShardSnapshot(count int, format Formatter) *shardSnapshot {
+	return &shardSnapshot{
+		shardsCount: count,
+		postfixes:   format.affixes(count),
+	}
+}
+
+// newKeyWrapper creates a new keyWrapper instance with the specified shard count
+// and postfix format. The wrapper starts with counter at 0 and will generate
+// postfixes starting from the first shard (":1" in the default format).
+func newKeyWrapper(count int, format Formatter) *keyWrapper {
+	return newStripedKeyWrapper(count, format, 0)
+}
+
+// newStripedKeyWrapper creates a new keyWrapper that rotates over the shards
+// with the given number of counter stripes. Every stripe cycles through all
+// shards on its own, starting at a different shard, and a caller uses the stripe
+// of its processor, so concurrent callers rarely touch the same cache line.
+// Each stripe stays even within one key, so the overall skew between shards
+// is at most the number of stripes. With less than two stripes a single counter
+// is used and the rotation is exact.
+func newStripedKeyWrapper(count int, format Formatter, stripes int) *keyWrapper {
+	return newSnapshotKeyWrapper(newShardSnapshot(count, format), format, stripes)
 }
 
-// newKeyWrapper creates a new keyWrapper instance with the specified shard count.
-// The wrapper starts with counter at 0 and will generate postfixes starting from ":1".
-func newKeyWrapper(count int) *keyWrapper {
-	w := &keyWrapper{}
-	w.setCount(count)
+// newSnapshotKeyWrapper creates a new keyWrapper like newStripedKeyWrapper
+// that starts with the given snapshot, which must match the format.
+func newSnapshotKeyWrapper(snap *shardSnapshot, format Formatter, stripes int) *keyWrapper {
+	w := &keyWrapper{format: format}
+	w.resetSnapshot(snap)
+
+	if stripes > 1 {
+		w.stripes = make([]counterStripe, stripes)
+		for k := range w.stripes {
+			w.stripes[k].i = int64(k)
+		}
+
+		w.stripeIDs.New = func() interface{} {
+			id := int(atomic.AddUint32(&w.nextStripe, 1)-1) % len(w.stripes)
+			return &id
+		}
+	}
 
 	return w
 }
@@ -60,32 +129,76 @@ func (b *keyWrapper) ResetShardsCount(count int) {
 	b.setCount(count)
 }
 
-// setCount updates the shard count in a thread-safe manner.
+// setCount swaps in a snapshot with the new shard count and a rebuilt
+// postfix table, so wrapping a key does not render the postfix.
 // This method doesn't reset the counter position to maintain distribution consistency.
 func (b *keyWrapper) setCount(count int) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	b.resetSnapshot(newShardSnapshot(count, b.format))
+}
 
-	b.shardsCount = count
+// resetSnapshot swaps in a snapshot built by the factory for all its wrappers.
+// Like setCount, it doesn't reset the counter position.
+func (b *keyWrapper) resetSnapshot(snap *shardSnapshot) {
+	b.snapshot.Store(snap)
 }
 
-// makePostfix generates the next shard postfix in the cycle.
-// For single shard (shardsCount <= 1), it always returns ":1".
-// For multiple shards, it increments the counter and wraps around when necessary.
-// This method is thread-safe and ensures even distribution.
-func (b *keyWrapper) makePostfix() string {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	if b.shardsCount > 1 {
-		b.i++
-		if b.i > b.shardsCount {
-			b.i = 1
+// reserve advances the counter by n shards in the cycle in a single step and
+// returns the first of them together with the snapshot they belong to.
+// For single shard (shardsCount <= 1), it always returns 1 without advancing.
+// When the counter is beyond a decreased shard count, the cycle restarts at 1.
+func (b *keyWrapper) reserve(n int) (int, *shardSnapshot) {
+	if b.stripes == nil {
+		return b.reserveOn(&b.i, n)
+	}
+
+	// sync.Pool keeps entries per processor, so the stripe index
+	// taken from it is mostly the same for the current processor
+	id := b.stripeIDs.Get().(*int)
+	shard, snap := b.reserveOn(&b.stripes[*id].i, n)
+	b.stripeIDs.Put(id)
+
+	return shard, snap
+}
+
+// reserveOn implements reserve for the given counter.
+func (b *keyWrapper) reserveOn(counter *int64, n int) (int, *shardSnapshot) {
+	snap := b.snapshot.Load().(*shardSnapshot)
+	if snap.shardsCount <= 1 {
+		return 1, snap
+	}
+
+	count := int64(snap.shardsCount)
+
+	for {
+		cur := atomic.LoadInt64(counter)
+
+		first := cur + 1
+		if first > count {
+			first = 1
+		}
+
+		last := (first-1+int64(n-1))%count + 1
+		if atomic.CompareAndSwapInt64(counter, cur, last) {
+			return int(first), snap
 		}
-		return ":" + strconv.Itoa(b.i)
 	}
+}
 
-	return defaultPostfix
+// nextShard returns the next shard number in the cycle.
+// For single shard (shardsCount <= 1), it always returns 1.
+// For multiple shards, it increments the counter and wraps around when necessary.
+// This method is thread-safe and ensures even distribution.
+func (b *keyWrapper) nextShard() int {
+	shard, _ := b.reserve(1)
+
+	return shard
+}
+
+// nextPostfix returns the precomputed postfix of the next shard in the cycle.
+func (b *keyWrapper) nextPostfix() string {
+	shard, snap := b.reserve(1)
+
+	return snap.postfixes[shard-1]
 }
 
 // WrapKey wraps the given key with an appropriate shard postfix.
@@ -94,5 +207,61 @@ func (b *keyWrapper) makePostfix() string {
 // to ensure even distribution across shards.
 // Example: "user:123" -> "user:123:2"
 func (b *keyWrapper) WrapKey(key string) string {
-	return key + b.makePostfix()
+	return b.format.attach(key, b.nextPostfix())
+}
+
+// AppendWrappedKey appends the given key wrapped with the next shard postfix
+// to dst and returns the extended buffer. It does not allocate if dst has
+// enough capacity, which makes it suitable for hot paths:
+//
+//	buf = wrapper.AppendWrappedKey(buf[:0], "user:123")
+func (b *keyWrapper) AppendWrappedKey(dst []byte, key string) []byte {
+	return b.format.appendAttached(dst, key, b.nextPostfix())
+}
+
+// WrapKeys wraps a batch of keys with a single counter update.
+// With BatchRotating the cycle continues across the keys,
+// with BatchShared all keys get the next shard in the cycle.
+func (b *keyWrapper) WrapKeys(keys []string, mode BatchMode) []ShardKeys {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	shards := make([]int, len(keys))
+
+	if mode == BatchShared {
+		shard := b.nextShard()
+		for i := range shards {
+			shards[i] = shard
+		}
+	} else {
+		first, snap := b.reserve(len(keys))
+		for i := range shards {
+			shards[i] = 1
+			if snap.shardsCount > 1 {
+				shards[i] = (first-1+i)%snap.shardsCount + 1
+			}
+		}
+	}
+
+	return groupByShard(b.format, keys, shards)
+}
+
+// PinShard picks the next shard in the cycle and pins it into a copy of ctx.
+// A pinned shard is kept if the shard count changes afterwards, or mapped
+// onto the remaining shards if the count drops below it, so all keys
+// of the request stay together.
+func (b *keyWrapper) PinShard(ctx context.Context) context.Context {
+	return withPinnedShard(ctx, b, b.nextShard())
+}
+
+// WrapKeyContext wraps the given key with the shard pinned into ctx
+// by PinShard, or with the next shard in the cycle if there is no pin.
+func (b *keyWrapper) WrapKeyContext(ctx context.Context, key string) string {
+	if shard, ok := pinnedShard(ctx, b); ok {
+		snap := b.snapshot.Load().(*shardSnapshot)
+		return b.format.attach(key, snap.postfixes[pinWithin(shard, len(snap.postfixes))-1])
+	}
+
+	return b.WrapKey(key)
 }
@@ -2,13 +2,14 @@ package key_wrapper
 
 import (
 	"strconv"
+	"sync"
 	"testing"
 )
 
 func TestWrapKey(t *testing.T) {
 	const shardsCount = 4
 
-	kw := newKeyWrapper(shardsCount)
+	kw := newKeyWrapper(shardsCount, Formatter{})
 
 	// Test cycling through shard postfixes
 	expectedPostfixes := []string{":1", ":2", ":3", ":4", ":1", ":2", ":3", ":4"}
@@ -27,7 +28,7 @@ func TestKeyWrapper_WrapKey(t *testing.T) {
 	t.Run("shards count 0 or 1", func(t *testing.T) {
 
 		check := func(shardsCount int) {
-			kw := newKeyWrapper(shardsCount)
+			kw := newKeyWrapper(shardsCount, Formatter{})
 
 			key := "key"
 			exp := key + ":1"
@@ -46,7 +47,7 @@ func TestKeyWrapper_WrapKey(t *testing.T) {
 	t.Run("shards count > 1", func(t *testing.T) {
 		const shardsCount = 6
 
-		kw := newKeyWrapper(shardsCount)
+		kw := newKeyWrapper(shardsCount, Formatter{})
 		key := "key"
 
 		var j int
@@ -66,3 +67,278 @@ func TestKeyWrapper_WrapKey(t *testing.T) {
 		}
 	})
 }
+
+func TestKeyWrapper_AppendWrappedKey(t *testing.T) {
+	t.Run("matches WrapKey", func(t *testing.T) {
+		formats := []Formatter{{}, {Delimiter: "/", Width: 3, Prefix: true}}
+
+		for _, format := range formats {
+			a := newKeyWrapper(3, format)
+			b := newKeyWrapper(3, format)
+
+			var buf []byte
+			for i := 0; i < 7; i++ {
+				buf = a.AppendWrappedKey(buf[:0], "user:123")
+
+				if got, exp := string(buf), b.WrapKey("user:123"); got != exp {
+					t.Fatalf("got=%s, exp=%s", got, exp)
+				}
+			}
+		}
+	})
+
+	t.Run("follows shard count changes", func(t *testing.T) {
+		kw := newKeyWrapper(2, Formatter{})
+
+		kw.ResetShardsCount(4)
+
+		var buf []byte
+		for _, exp := range []string{"key:1", "key:2", "key:3", "key:4", "key:1"} {
+			buf = kw.AppendWrappedKey(buf[:0], "key")
+			if string(buf) != exp {
+				t.Fatalf("got=%s, exp=%s", buf, exp)
+			}
+		}
+	})
+
+	t.Run("zero allocations", func(t *testing.T) {
+		kw := newKeyWrapper(10, Formatter{})
+		buf := make([]byte, 0, 64)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			buf = kw.AppendWrappedKey(buf[:0], "user:123")
+		})
+
+		if allocs != 0 {
+			t.Fatalf("got=%v allocs, exp=0", allocs)
+		}
+	})
+}
+
+func TestKeyWrapper_Concurrent(t *testing.T) {
+	t.Run("exact rotation", func(t *testing.T) {
+		const (
+			shardsCount = 4
+			goroutines  = 8
+			calls       = 1000
+		)
+
+		kw := newKeyWrapper(shardsCount, Formatter{})
+
+		var (
+			mu     sync.Mutex
+			counts = make(map[string]int)
+			wg     sync.WaitGroup
+		)
+
+		wg.Add(goroutines)
+		for g := 0; g < goroutines; g++ {
+			go func() {
+				defer wg.Done()
+
+				local := make(map[string]int)
+				for i := 0; i < calls; i++ {
+					local[kw.WrapKey("key")]++
+				}
+
+				mu.Lock()
+				for key, n := range local {
+					counts[key] += n
+				}
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		for shard := 1; shard <= shardsCount; shard++ {
+			key := "key:" + strconv.Itoa(shard)
+			if counts[key] != goroutines*calls/shardsCount {
+				t.Fatalf("%s: got=%d, exp=%d", key, counts[key], goroutines*calls/shardsCount)
+			}
+		}
+	})
+
+	t.Run("counts change while wrapping", func(t *testing.T) {
+		kw := newKeyWrapper(4, Formatter{})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 1000; i++ {
+				kw.ResetShardsCount(i%5 + 1)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 1000; i++ {
+				if _, shard, err := (Formatter{}).ParseWrappedKey(kw.WrapKey("key")); err != nil || shard > 5 {
+					t.Errorf("unexpected shard %d: %v", shard, err)
+					return
+				}
+			}
+		}()
+
+		wg.Wait()
+	})
+
+	t.Run("cycle restarts after decrease", func(t *testing.T) {
+		kw := newKeyWrapper(4, Formatter{})
+		for i := 0; i < 3; i++ {
+			kw.WrapKey("key")
+		}
+
+		kw.ResetShardsCount(2)
+
+		for _, exp := range []string{"key:1", "key:2", "key:1"} {
+			if got := kw.WrapKey("key"); got != exp {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		}
+	})
+}
+
+func TestKeyWrapper_Striped(t *testing.T) {
+	t.Run("skew stays within the stripe count", func(t *testing.T) {
+		const (
+			shardsCount = 7
+			stripes     = 8
+			goroutines  = 16
+			calls       = 5000
+		)
+
+		kw := newStripedKeyWrapper(shardsCount, Formatter{}, stripes)
+
+		var (
+			mu     sync.Mutex
+			counts = make([]int, shardsCount+1)
+			wg     sync.WaitGroup
+		)
+
+		wg.Add(goroutines)
+		for g := 0; g < goroutines; g++ {
+			go func() {
+				defer wg.Done()
+
+				local := make([]int, shardsCount+1)
+				for i := 0; i < calls; i++ {
+					local[kw.nextShard()]++
+				}
+
+				mu.Lock()
+				for shard, n := range local {
+					counts[shard] += n
+				}
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		min, max := counts[1], counts[1]
+		for _, n := range counts[1:] {
+			if n < min {
+				min = n
+			}
+
+			if n > max {
+				max = n
+			}
+		}
+
+		if max-min > stripes {
+			t.Fatalf("skew %d exceeds %d: %v", max-min, stripes, counts[1:])
+		}
+
+		// relative skew against the ideal share of every shard
+		ideal := float64(goroutines*calls) / shardsCount
+		if skew := float64(max-min) / ideal; skew > 0.01 {
+			t.Fatalf("relative skew %.4f exceeds 0.01: %v", skew, counts[1:])
+		}
+	})
+
+	t.Run("every postfix is used", func(t *testing.T) {
+		kw := newStripedKeyWrapper(3, Formatter{}, 4)
+
+		seen := make(map[string]bool)
+		for i := 0; i < 30; i++ {
+			seen[kw.WrapKey("key")] = true
+		}
+
+		for _, exp := range []string{"key:1", "key:2", "key:3"} {
+			if !seen[exp] {
+				t.Fatalf("%s was never used: %v", exp, seen)
+			}
+		}
+	})
+
+	t.Run("follows shard count changes", func(t *testing.T) {
+		kw := newStripedKeyWrapper(5, Formatter{}, 4)
+		kw.ResetShardsCount(2)
+
+		for i := 0; i < 100; i++ {
+			if shard := kw.nextShard(); shard < 1 || shard > 2 {
+				t.Fatalf("got shard %d, exp 1..2", shard)
+			}
+		}
+	})
+}
+
+func TestWithStripedCounters(t *testing.T) {
+	for _, stripes := range []int{0, -1, maxCounterStripes + 1} {
+		if _, err := NewFactory(1, WithStripedCounters(stripes)); err == nil {
+			t.Fatalf("stripes %d: expected error, got nil", stripes)
+		}
+	}
+
+	f, err := NewFactory(4, WithStripedCounters(2))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	if kw := f.MakeKeyWrapper().(*ownedKeyWrapper); len(kw.stripes) != 2 {
+		t.Fatalf("got=%d stripes, exp=2", len(kw.stripes))
+	}
+
+	if kw := f.MakeOnlyGrowingKeyWrapper().(*ownedKeyWrapper); len(kw.stripes) != 2 {
+		t.Fatalf("got=%d stripes, exp=2", len(kw.stripes))
+	}
+}
+
+func TestFactory_SharedShardSnapshot(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	general := f.MakeKeyWrapper().(*ownedKeyWrapper)
+	growing := f.MakeOnlyGrowingKeyWrapper().(*ownedKeyWrapper)
+	hashed := f.MakeHashKeyWrapper().(*ownedWrapper).KeyWrapper.(*hashKeyWrapper)
+
+	if err := f.compareAndUpdate(3); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+
+	// every wrapper gets the snapshot built once by the factory
+	snap := f.shards
+	if snap.shardsCount != 3 {
+		t.Fatalf("got=%d shards, exp=3", snap.shardsCount)
+	}
+
+	for name, got := range map[string]interface{}{
+		"general": general.snapshot.Load(),
+		"growing": growing.snapshot.Load(),
+		"hash":    hashed.snapshot.Load(),
+	} {
+		if got != snap {
+			t.Fatalf("%s wrapper does not use the factory snapshot", name)
+		}
+	}
+
+	if got := f.MakeKeyWrapper().(*ownedKeyWrapper).snapshot.Load(); got != snap {
+		t.Fatal("new wrapper does not use the factory snapshot")
+	}
+}
@@ -0,0 +1,47 @@
+package key_wrapper
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMissingPostfix is returned when a wrapped key has no shard postfix.
+	ErrMissingPostfix = errors.New("missing shard postfix")
+	// ErrEmptyBaseKey is returned when a wrapped key has nothing before its postfix.
+	ErrEmptyBaseKey = errors.New("empty base key")
+	// ErrInvalidShard is returned when the shard postfix is not a shard number
+	// the wrappers could have produced.
+	ErrInvalidShard = errors.New("invalid shard number")
+)
+
+// ParseError describes a wrapped key that could not be parsed.
+// Err is one of ErrMissingPostfix, ErrEmptyBaseKey or ErrInvalidShard,
+// so it can be checked with errors.Is.
+type ParseError struct {
+	Key string // the wrapped key that failed to parse
+	Err error  // the reason of the failure
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse wrapped key %q: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the reason of the failure.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseWrappedKey is the inverse of WrapKey for numbered shard postfixes
+// in the default format. It splits a wrapped key at its last ":" into
+// the base key and the shard number.
+// Example: "user:123:4" -> "user:123", 4
+//
+// Keys of a factory with a custom Formatter are parsed with
+// Factory.ParseWrappedKey or Formatter.ParseWrappedKey instead.
+// Keys wrapped with named shard IDs (rendezvous wrappers) are not numbered
+// and are reported as ErrInvalidShard.
+func ParseWrappedKey(wrapped string) (string, int, error) {
+	return Formatter{}.ParseWrappedKey(wrapped)
+}
@@ -0,0 +1,75 @@
+package key_wrapper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseWrappedKey(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		tests := []struct {
+			wrapped string
+			base    string
+			shard   int
+		}{
+			{"user:123:4", "user:123", 4},
+			{"key:1", "key", 1},
+			{"a::10000", "a:", 10000},
+		}
+
+		for _, tt := range tests {
+			base, shard, err := ParseWrappedKey(tt.wrapped)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.wrapped, err)
+			}
+
+			if base != tt.base || shard != tt.shard {
+				t.Fatalf("%s: got (%s, %d), exp (%s, %d)", tt.wrapped, base, shard, tt.base, tt.shard)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			wrapped string
+			err     error
+		}{
+			{"user", ErrMissingPostfix},
+			{":1", ErrEmptyBaseKey},
+			{"user:", ErrInvalidShard},
+			{"user:0", ErrInvalidShard},
+			{"user:04", ErrInvalidShard},
+			{"user:-4", ErrInvalidShard},
+			{"user:+4", ErrInvalidShard},
+			{"user:10001", ErrInvalidShard},
+			{"user:redis-a", ErrInvalidShard},
+		}
+
+		for _, tt := range tests {
+			_, _, err := ParseWrappedKey(tt.wrapped)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("%s: expected %v, got %v", tt.wrapped, tt.err, err)
+			}
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Key != tt.wrapped {
+				t.Fatalf("%s: expected *ParseError, got %v", tt.wrapped, err)
+			}
+		}
+	})
+
+	t.Run("inverse of WrapKey", func(t *testing.T) {
+		kw := newKeyWrapper(7, Formatter{})
+
+		for i := 1; i <= 14; i++ {
+			base, shard, err := ParseWrappedKey(kw.WrapKey("user:123"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if base != "user:123" || shard != (i-1)%7+1 {
+				t.Fatalf("got (%s, %d)", base, shard)
+			}
+		}
+	})
+}
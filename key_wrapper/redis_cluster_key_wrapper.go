@@ -0,0 +1,302 @@
+package key_wrapper
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// RedisClusterSlots is the number of hash slots of a Redis Cluster.
+	RedisClusterSlots = 16384
+	// maxClusterTagAttempts limits the search for a hash tag that lands on
+	// the node of a logical shard. With N masters a candidate hits the node
+	// with probability of about 1/N, so the limit is practically never reached.
+	maxClusterTagAttempts = 1024
+)
+
+// ClusterSlotRange is a range of Redis Cluster hash slots served by one master node.
+type ClusterSlotRange struct {
+	Start int    // first slot of the range, inclusive
+	End   int    // last slot of the range, inclusive
+	Node  string // identifier of the master node serving the range
+}
+
+// ResetClusterSlots defines the interface for objects that can have their
+// Redis Cluster slot map updated. This interface is used by the factory
+// to update all registered Redis Cluster wrappers when the slot map changes.
+type ResetClusterSlots interface {
+	// ResetClusterSlots updates the slot ranges served by the master nodes.
+	ResetClusterSlots(ranges []ClusterSlotRange)
+}
+
+// Compile-time interface compliance checks
+var _ KeyWrapper = (*redisClusterKeyWrapper)(nil)
+var _ ResetClusterSlots = (*redisClusterKeyWrapper)(nil)
+
+// redisClusterKeyWrapper is a KeyWrapper for Redis Cluster. Every master node
+// is a logical shard, and keys rotate over the shards like keyWrapper does.
+// The key is wrapped into a hash tag ("{user:123:s1}") chosen so that its
+// CRC16 slot is served by the shard's master, which spreads the shards
+// over different masters instead of relying on luck.
+//
+// The chosen tag only depends on the key, the shard and the slot map,
+// so readers can compute it as well with Factory.AllClusterKeys.
+type redisClusterKeyWrapper struct {
+	mu     sync.Mutex     // protects i and tagger from concurrent access
+	i      int            // current position in the cycle (1 to the number of shards)
+	tagger *clusterTagger // tag search over the current slot map
+	format Formatter      // renders shard IDs and delimiters inside the tag
+	misses *int64         // tag searches without a match, shared with the factory
+}
+
+// newRedisClusterKeyWrapper creates a new redisClusterKeyWrapper instance
+// with the specified slot map and key format. Failed tag searches are
+// counted in misses.
+func newRedisClusterKeyWrapper(ranges []ClusterSlotRange, format Formatter, misses *int64) *redisClusterKeyWrapper {
+	return newRedisClusterKeyWrapperWithTagger(newClusterTagger(ranges, format), format, misses)
+}
+
+// newRedisClusterKeyWrapperWithTagger creates a new redisClusterKeyWrapper
+// instance that starts with the given tagger, which must match the format.
+func newRedisClusterKeyWrapperWithTagger(tagger *clusterTagger, format Formatter, misses *int64) *redisClusterKeyWrapper {
+	w := &redisClusterKeyWrapper{format: format, misses: misses}
+	w.resetTagger(tagger)
+
+	return w
+}
+
+// ResetClusterSlots updates the slot map for this wrapper.
+// Without any ranges all keys are wrapped for a single logical shard.
+func (r *redisClusterKeyWrapper) ResetClusterSlots(ranges []ClusterSlotRange) {
+	r.resetTagger(newClusterTagger(ranges, r.format))
+}
+
+// resetTagger swaps in a tagger built by the factory for all its wrappers.
+func (r *redisClusterKeyWrapper) resetTagger(tagger *clusterTagger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tagger = tagger
+}
+
+// WrapKey wraps the given key into a hash tag for the next shard in the cycle.
+// Example: "user:123" -> "{user:123:s1}", "{user:123:s2.3}", ...
+// where the tag lands on a slot served by the master of the shard.
+// Only the shard is reserved under the lock; the tag search runs without it.
+func (r *redisClusterKeyWrapper) WrapKey(key string) string {
+	r.mu.Lock()
+
+	tagger := r.tagger
+
+	r.i++
+	if r.i > tagger.shards() {
+		r.i = 1
+	}
+
+	shard := r.i
+
+	r.mu.Unlock()
+
+	tag, ok := tagger.tag(key, shard)
+	if !ok {
+		atomic.AddInt64(r.misses, 1)
+	}
+
+	return tag
+}
+
+// clusterTagger finds the hash-tagged keys that land on the masters of
+// a Redis Cluster slot map. It is immutable once created, so it can be
+// used without locking.
+type clusterTagger struct {
+	nodes  []string  // master nodes sorted by identifier, node i+1 is shard i+1
+	owners []int     // shard number serving every slot, 0 if no node serves it
+	format Formatter // renders shard IDs and delimiters inside the tag
+}
+
+// newClusterTagger creates a clusterTagger for the slot map and key format.
+func newClusterTagger(ranges []ClusterSlotRange, format Formatter) *clusterTagger {
+	nodes := clusterNodes(ranges)
+
+	shards := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		shards[node] = i + 1
+	}
+
+	var owners []int
+	if len(ranges) > 0 {
+		owners = make([]int, RedisClusterSlots)
+		for _, rng := range ranges {
+			for slot := rng.Start; slot <= rng.End; slot++ {
+				owners[slot] = shards[rng.Node]
+			}
+		}
+	}
+
+	return &clusterTagger{nodes: nodes, owners: owners, format: format}
+}
+
+// shards returns the number of logical shards, at least 1.
+func (c *clusterTagger) shards() int {
+	if len(c.nodes) < 1 {
+		return 1
+	}
+
+	return len(c.nodes)
+}
+
+// tag returns the wrapped key whose slot is served by the master of the shard.
+// If no candidate within maxClusterTagAttempts lands there, e.g. because the
+// master serves very few slots, it returns the first candidate and false.
+func (c *clusterTagger) tag(key string, shard int) (string, bool) {
+	if len(c.nodes) <= 1 {
+		return c.candidate(key, shard, 0), true
+	}
+
+	for attempt := 0; attempt < maxClusterTagAttempts; attempt++ {
+		tag := c.candidate(key, shard, attempt)
+		if c.owners[RedisSlot(tag)] == shard {
+			return tag, true
+		}
+	}
+
+	return c.candidate(key, shard, 0), false
+}
+
+// candidate builds the hash-tagged key for the shard and search attempt with
+// the salt "s<shard>" for the first attempt and "s<shard>.<attempt>" afterwards.
+// The salt is placed where the hash tag rules of Redis always hash it:
+//   - a key with a hash tag gets the salt inside that tag, so keys sharing
+//     a tag stay together on every shard: "{user}:123" -> "{user:s1}:123"
+//   - a key without "}" becomes the tag: "user:123" -> "{user:123:s1}"
+//   - any other key, whose "}" would end the tag early, gets the salt as
+//     a tag in front: "a}b" -> "{s1}a}b"
+func (c *clusterTagger) candidate(key string, shard, attempt int) string {
+	salt := "s" + c.format.FormatShard(shard)
+	if attempt > 0 {
+		salt += "." + strconv.Itoa(attempt)
+	}
+
+	if start, end, ok := hashTag(key); ok {
+		return key[:start+1] + c.format.JoinKey(key[start+1:end], salt) + key[end:]
+	}
+
+	if strings.IndexByte(key, '}') < 0 {
+		return "{" + c.format.JoinKey(key, salt) + "}"
+	}
+
+	return "{" + salt + "}" + key
+}
+
+// hashTag returns the positions of the braces of the hash tag of the key
+// and whether it has one, following the hash tag rules of Redis: the first
+// "{" and the first "}" after it, with a non-empty content in between.
+func hashTag(key string) (start, end int, ok bool) {
+	start = strings.IndexByte(key, '{')
+	if start < 0 {
+		return 0, 0, false
+	}
+
+	n := strings.IndexByte(key[start+1:], '}')
+	if n <= 0 {
+		return 0, 0, false
+	}
+
+	return start, start + 1 + n, true
+}
+
+// clusterNodes returns the distinct nodes of the ranges sorted by identifier.
+func clusterNodes(ranges []ClusterSlotRange) []string {
+	seen := make(map[string]struct{}, len(ranges))
+
+	var nodes []string
+	for _, rng := range ranges {
+		if _, ok := seen[rng.Node]; ok {
+			continue
+		}
+
+		seen[rng.Node] = struct{}{}
+		nodes = append(nodes, rng.Node)
+	}
+
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+// validateClusterSlots checks if the provided slot map can be used:
+// ranges must lie within the cluster slots, name their node and not overlap.
+func validateClusterSlots(ranges []ClusterSlotRange) error {
+	if len(ranges) == 0 {
+		return errors.New("cluster slot ranges must not be empty")
+	}
+
+	sorted := make([]ClusterSlotRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	for i, rng := range sorted {
+		if rng.Node == "" {
+			return fmt.Errorf("cluster slot range %d-%d has no node", rng.Start, rng.End)
+		}
+
+		if rng.Start < 0 || rng.End >= RedisClusterSlots || rng.Start > rng.End {
+			return fmt.Errorf("invalid cluster slot range %d-%d", rng.Start, rng.End)
+		}
+
+		if i > 0 && rng.Start <= sorted[i-1].End {
+			return fmt.Errorf("cluster slot ranges %d-%d and %d-%d overlap",
+				sorted[i-1].Start, sorted[i-1].End, rng.Start, rng.End)
+		}
+	}
+
+	return nil
+}
+
+// RedisSlot returns the Redis Cluster hash slot of the key, following the
+// hash tag rules of Redis: if the key contains "{...}" with a non-empty
+// content, only that content is hashed.
+func RedisSlot(key string) int {
+	if start, end, ok := hashTag(key); ok {
+		key = key[start+1 : end]
+	}
+
+	return int(crc16(key)) % RedisClusterSlots
+}
+
+// crc16Table is the lookup table of the CRC16-CCITT (XMODEM) checksum used by Redis Cluster.
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+
+		table[i] = crc
+	}
+
+	return table
+}()
+
+// crc16 returns the CRC16-CCITT (XMODEM) checksum of s.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+
+	return crc
+}
@@ -0,0 +1,225 @@
+package key_wrapper
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// threeMasters is the default slot split of a three-master Redis Cluster.
+var threeMasters = []ClusterSlotRange{
+	{Start: 0, End: 5460, Node: "node-a"},
+	{Start: 5461, End: 10922, Node: "node-b"},
+	{Start: 10923, End: 16383, Node: "node-c"},
+}
+
+func TestRedisSlot(t *testing.T) {
+	tests := map[string]int{
+		"foo":                  12182,
+		"bar":                  5061,
+		"123456789":            0x31C3 % RedisClusterSlots,
+		"{user1000}.following": RedisSlot("user1000"),
+		"{user1000}.followers": RedisSlot("user1000"),
+		"foo{{bar}}zap":        RedisSlot("{bar"),
+		"foo{bar}{zap}":        RedisSlot("bar"),
+	}
+
+	for key, exp := range tests {
+		if got := RedisSlot(key); got != exp {
+			t.Fatalf("%s: got=%d, exp=%d", key, got, exp)
+		}
+	}
+
+	// an empty hash tag hashes the whole key
+	if RedisSlot("foo{}{bar}") == RedisSlot("bar") {
+		t.Fatal("empty hash tag must not be used")
+	}
+}
+
+func TestRedisClusterKeyWrapper_WrapKey(t *testing.T) {
+	t.Run("shards land on their masters", func(t *testing.T) {
+		kw := newRedisClusterKeyWrapper(threeMasters, Formatter{}, new(int64))
+
+		for i := 0; i < 300; i++ {
+			key := "user:" + strconv.Itoa(i)
+			shard := i%3 + 1
+
+			got := kw.WrapKey(key)
+			if owner := kw.tagger.owners[RedisSlot(got)]; owner != shard {
+				t.Fatalf("%s: got shard %d, exp=%d", got, owner, shard)
+			}
+		}
+	})
+
+	t.Run("stable tags for the same slot map", func(t *testing.T) {
+		a := newRedisClusterKeyWrapper(threeMasters, Formatter{}, new(int64))
+		b := newRedisClusterKeyWrapper(threeMasters, Formatter{}, new(int64))
+
+		for i := 0; i < 30; i++ {
+			key := "user:" + strconv.Itoa(i)
+			if got, exp := a.WrapKey(key), b.WrapKey(key); got != exp {
+				t.Fatalf("got=%s, exp=%s", got, exp)
+			}
+		}
+	})
+
+	t.Run("keys with braces", func(t *testing.T) {
+		kw := newRedisClusterKeyWrapper(threeMasters, Formatter{}, new(int64))
+
+		for _, key := range []string{"{user}:123", "{user}:456", "a}b", "foo{}{bar}", "x{y"} {
+			for shard := 1; shard <= 3; shard++ {
+				got := kw.WrapKey(key)
+				if owner := kw.tagger.owners[RedisSlot(got)]; owner != shard {
+					t.Fatalf("%s -> %s: got shard %d, exp=%d", key, got, owner, shard)
+				}
+			}
+		}
+
+		if got := *kw.misses; got != 0 {
+			t.Fatalf("got=%d misses, exp=0", got)
+		}
+
+		// keys sharing a hash tag stay together on every shard
+		a, _ := kw.tagger.tag("{user}:123", 2)
+		b, _ := kw.tagger.tag("{user}:456", 2)
+		if a[:strings.IndexByte(a, '}')] != b[:strings.IndexByte(b, '}')] {
+			t.Fatalf("got=%s and %s, exp the same hash tag", a, b)
+		}
+
+		if !strings.HasSuffix(a, "}:123") || !strings.HasPrefix(a, "{user:s") {
+			t.Fatalf("got=%s, exp={user:s<shard>}:123", a)
+		}
+	})
+
+	t.Run("counts misses", func(t *testing.T) {
+		// node-b serves a single slot, which the search practically never hits
+		ranges := []ClusterSlotRange{
+			{Start: 0, End: 99, Node: "node-a"},
+			{Start: 100, End: 100, Node: "node-b"},
+			{Start: 101, End: 16383, Node: "node-c"},
+		}
+
+		misses := new(int64)
+		kw := newRedisClusterKeyWrapper(ranges, Formatter{}, misses)
+
+		kw.WrapKey("user:123")
+		kw.WrapKey("user:123")
+
+		if *misses != 1 {
+			t.Fatalf("got=%d misses, exp=1", *misses)
+		}
+	})
+
+	t.Run("single shard without slot map", func(t *testing.T) {
+		kw := newRedisClusterKeyWrapper(nil, Formatter{}, new(int64))
+
+		for i := 0; i < 3; i++ {
+			if got := kw.WrapKey("user:123"); got != "{user:123:s1}" {
+				t.Fatalf("got=%s, exp={user:123:s1}", got)
+			}
+		}
+	})
+}
+
+func TestFactory_MakeRedisClusterKeyWrapper(t *testing.T) {
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeRedisClusterKeyWrapper()
+
+	if got := w.WrapKey("key"); got != "{key:s1}" {
+		t.Fatalf("got=%s, exp={key:s1}", got)
+	}
+
+	// ranges are accepted in any order
+	ranges := []ClusterSlotRange{threeMasters[2], threeMasters[0], threeMasters[1]}
+	if err := f.compareAndUpdateClusterSlots(ranges); err != nil {
+		t.Fatalf("compareAndUpdateClusterSlots: %v", err)
+	}
+
+	nodes := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		nodes[clusterSlotNode(threeMasters, RedisSlot(w.WrapKey("key")))] = true
+	}
+
+	if len(nodes) != 3 {
+		t.Fatalf("expected keys on 3 masters, got %d", len(nodes))
+	}
+
+	// wrappers share the tagger of the factory instead of building their own
+	if w.(*ownedWrapper).KeyWrapper.(*redisClusterKeyWrapper).tagger != f.clusterTagger {
+		t.Fatal("wrapper does not use the factory tagger")
+	}
+
+	if f.MakeRedisClusterKeyWrapper().(*ownedWrapper).KeyWrapper.(*redisClusterKeyWrapper).tagger != f.clusterTagger {
+		t.Fatal("new wrapper does not use the factory tagger")
+	}
+
+	stats := f.Stats()
+	if stats.ClusterWrappers != 2 || stats.ClusterNodes != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+// clusterSlotNode returns the node of the range serving the slot.
+func clusterSlotNode(ranges []ClusterSlotRange, slot int) string {
+	for _, rng := range ranges {
+		if slot >= rng.Start && slot <= rng.End {
+			return rng.Node
+		}
+	}
+
+	return ""
+}
+
+func TestValidateClusterSlots(t *testing.T) {
+	invalid := map[string][]ClusterSlotRange{
+		"empty list":   {},
+		"no node":      {{Start: 0, End: 10}},
+		"out of range": {{Start: 0, End: RedisClusterSlots, Node: "a"}},
+		"reversed":     {{Start: 10, End: 5, Node: "a"}},
+		"overlap":      {{Start: 0, End: 10, Node: "a"}, {Start: 10, End: 20, Node: "b"}},
+	}
+
+	for name, ranges := range invalid {
+		if err := validateClusterSlots(ranges); err == nil {
+			t.Fatalf("%s: expected error, got nil", name)
+		}
+	}
+
+	if err := validateClusterSlots(threeMasters); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestFactory_AllClusterKeys(t *testing.T) {
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	if got := f.AllClusterKeys("key"); !reflect.DeepEqual(got, []string{"{key:s1}"}) {
+		t.Fatalf("got=%v, exp=[{key:s1}]", got)
+	}
+
+	if err := f.compareAndUpdateClusterSlots(threeMasters); err != nil {
+		t.Fatalf("compareAndUpdateClusterSlots: %v", err)
+	}
+
+	w := f.MakeRedisClusterKeyWrapper()
+
+	for _, key := range []string{"user:123", "{user}:123"} {
+		written := []string{w.WrapKey(key), w.WrapKey(key), w.WrapKey(key)}
+
+		if got := f.AllClusterKeys(key); !reflect.DeepEqual(got, written) {
+			t.Fatalf("got=%v, exp=%v", got, written)
+		}
+	}
+
+	if got, exp := f.AllClusterKeys("user:123"), []string{"{user:123:s1.3}", "{user:123:s2}", "{user:123:s3.2}"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got=%v, exp=%v", got, exp)
+	}
+}
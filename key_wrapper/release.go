@@ -0,0 +1,125 @@
+package key_wrapper
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+// registration ties a wrapper returned by the factory to its entry in one of
+// the factory's stores. Closing it removes the entry, so the factory stops
+// updating the wrapper and no longer keeps it alive.
+type registration struct {
+	once    sync.Once
+	factory *Factory
+	remove  func() // removes the wrapper from its store, called with f.mu held
+}
+
+// Close unregisters the wrapper from the factory that created it.
+// The wrapper keeps its last shard configuration but no longer follows
+// shard changes, so it should not be used afterwards.
+// It is safe to call Close multiple times.
+func (r *registration) Close() error {
+	r.once.Do(func() {
+		r.factory.mu.Lock()
+		defer r.factory.mu.Unlock()
+
+		r.remove()
+	})
+
+	return nil
+}
+
+// registrationOf returns the registration of a wrapper returned by the factory.
+func (r *registration) registrationOf() *registration {
+	return r
+}
+
+// registered is implemented by all wrappers returned by the factory.
+type registered interface {
+	registrationOf() *registration
+}
+
+// register adds the wrapper implementation w to the store s and returns
+// the handle given to the caller, which unregisters w when closed or once it
+// becomes unreachable. The caller must hold f.mu.
+func (f *Factory) register(s *store, w interface{}) KeyWrapper {
+	s.add(w)
+
+	r := &registration{factory: f, remove: func() { s.remove(w) }}
+
+	h := own(w, r)
+	releaseWhenUnreachable(h, r)
+
+	return h
+}
+
+// releaseWhenUnreachable closes the registration once the handle returned
+// to the caller becomes unreachable, so wrappers that are dropped without
+// Close do not pile up in the factory's stores. The stores only reference
+// the wrapped implementation, never the handle.
+func releaseWhenUnreachable(handle interface{}, r *registration) {
+	runtime.SetFinalizer(handle, func(interface{}) {
+		_ = r.Close()
+	})
+}
+
+// Release unregisters a wrapper created by this factory, the same as calling
+// its Close method. Wrappers created by another factory are ignored.
+func (f *Factory) Release(w KeyWrapper) {
+	if r, ok := w.(registered); ok && r.registrationOf().factory == f {
+		_ = r.registrationOf().Close()
+	}
+}
+
+// The handles below are returned by the factory's Make methods. Each embeds
+// the wrapper implementation, so all its optional interfaces are kept,
+// and the registration, which adds Close. Wrappers without optional
+// interfaces share ownedWrapper.
+
+type ownedWrapper struct {
+	KeyWrapper
+	*registration
+}
+
+type ownedKeyWrapper struct {
+	*keyWrapper
+	*registration
+}
+
+type ownedWeightedKeyWrapper struct {
+	*weightedKeyWrapper
+	*registration
+}
+
+type ownedSlotKeyWrapper struct {
+	*slotKeyWrapper
+	*registration
+}
+
+// own returns the handle of the wrapper implementation w with the registration r.
+func own(w interface{}, r *registration) KeyWrapper {
+	switch w := w.(type) {
+	case *keyWrapper:
+		return &ownedKeyWrapper{keyWrapper: w, registration: r}
+	case *weightedKeyWrapper:
+		return &ownedWeightedKeyWrapper{weightedKeyWrapper: w, registration: r}
+	case *slotKeyWrapper:
+		return &ownedSlotKeyWrapper{slotKeyWrapper: w, registration: r}
+	default:
+		return &ownedWrapper{KeyWrapper: w.(KeyWrapper), registration: r}
+	}
+}
+
+// Compile-time interface compliance checks
+var _ io.Closer = (*ownedWrapper)(nil)
+var _ KeyWrapper = (*ownedWrapper)(nil)
+var _ io.Closer = (*ownedKeyWrapper)(nil)
+var _ AppendKeyWrapper = (*ownedKeyWrapper)(nil)
+var _ BatchKeyWrapper = (*ownedKeyWrapper)(nil)
+var _ ContextKeyWrapper = (*ownedKeyWrapper)(nil)
+var _ io.Closer = (*ownedWeightedKeyWrapper)(nil)
+var _ BatchKeyWrapper = (*ownedWeightedKeyWrapper)(nil)
+var _ ContextKeyWrapper = (*ownedWeightedKeyWrapper)(nil)
+var _ io.Closer = (*ownedSlotKeyWrapper)(nil)
+var _ SlotKeyWrapper = (*ownedSlotKeyWrapper)(nil)
@@ -0,0 +1,117 @@
+package key_wrapper
+
+import (
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFactory_CloseWrapper(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	wrappers := []KeyWrapper{
+		f.MakeKeyWrapper(),
+		f.MakeOnlyGrowingKeyWrapper(),
+		f.MakeHashKeyWrapper(),
+		f.MakeJumpHashKeyWrapper(),
+		f.MakeOnlyGrowingJumpHashKeyWrapper(),
+		f.MakeRendezvousKeyWrapper(),
+		f.MakeWeightedKeyWrapper(),
+		f.MakeSlotKeyWrapper(),
+		f.MakeRedisClusterKeyWrapper(),
+	}
+
+	for i, w := range wrappers {
+		c, ok := w.(io.Closer)
+		if !ok {
+			t.Fatalf("wrapper %d does not implement io.Closer", i)
+		}
+
+		if err := c.Close(); err != nil {
+			t.Fatalf("wrapper %d: Close: %v", i, err)
+		}
+
+		// closing twice is a no-op
+		if err := c.Close(); err != nil {
+			t.Fatalf("wrapper %d: second Close: %v", i, err)
+		}
+	}
+
+	stats := f.Stats()
+	live := stats.GeneralWrappers + stats.GrowingWrappers + stats.NamedWrappers +
+		stats.WeightedWrappers + stats.SlotWrappers + stats.ClusterWrappers
+	if live != 0 {
+		t.Fatalf("expected no live wrappers, got %+v", stats)
+	}
+}
+
+func TestFactory_Release(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	released := f.MakeKeyWrapper()
+	kept := f.MakeKeyWrapper()
+
+	f.Release(released)
+
+	if got := f.Stats().GeneralWrappers; got != 1 {
+		t.Fatalf("got=%d general wrappers, exp=1", got)
+	}
+
+	// a released wrapper no longer follows shard count changes
+	if err := f.compareAndUpdate(1); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	released.WrapKey("key")
+	if got := released.WrapKey("key"); got != "key:2" {
+		t.Fatalf("got=%s, exp=key:2", got)
+	}
+
+	if got := kept.WrapKey("key"); got != "key:1" {
+		t.Fatalf("got=%s, exp=key:1", got)
+	}
+
+	// wrappers of another factory are ignored
+	other, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	other.Release(kept)
+
+	if got := f.Stats().GeneralWrappers; got != 1 {
+		t.Fatalf("got=%d general wrappers, exp=1", got)
+	}
+}
+
+func TestFactory_ReleaseUnreachable(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		f.MakeKeyWrapper().WrapKey("key")
+	}
+
+	kept := f.MakeKeyWrapper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Stats().GeneralWrappers > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unreachable wrappers were not released: %+v", f.Stats())
+		}
+
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runtime.KeepAlive(kept)
+}
@@ -0,0 +1,113 @@
+package key_wrapper
+
+import (
+	"strconv"
+	"sync"
+)
+
+// ResetShardIDs defines the interface for objects that can have their
+// list of named shards updated. This interface is used by the factory
+// to update all registered named wrappers when the shard IDs change.
+type ResetShardIDs interface {
+	// ResetShardIDs updates the shard identifiers to the specified list.
+	ResetShardIDs(ids []string)
+}
+
+// Compile-time interface compliance checks
+var _ KeyWrapper = (*rendezvousKeyWrapper)(nil)
+var _ ResetShardIDs = (*rendezvousKeyWrapper)(nil)
+
+// rendezvousKeyWrapper is a KeyWrapper that picks a shard with highest random
+// weight (rendezvous) hashing. Every (key, shard ID) pair is scored and the
+// shard with the highest score wins, so removing one shard only remaps the
+// keys that were placed on it.
+type rendezvousKeyWrapper struct {
+	mu       sync.RWMutex // protects ids and idHashes from concurrent access
+	ids      []string     // identifiers of the shards keys are distributed over
+	idHashes []uint64     // precomputed hashes of ids, index-aligned with ids
+	format   Formatter    // attaches shard IDs to keys
+}
+
+// newRendezvousKeyWrapper creates a new rendezvousKeyWrapper instance
+// with the specified shard identifiers and key format.
+// Shard identifiers are attached to keys as they are; only the delimiter
+// and placement of the format apply to them.
+func newRendezvousKeyWrapper(ids []string, format Formatter) *rendezvousKeyWrapper {
+	w := &rendezvousKeyWrapper{format: format}
+	w.ResetShardIDs(ids)
+
+	return w
+}
+
+// ResetShardIDs updates the shard identifiers for this wrapper.
+// Only keys whose winning shard was removed, or which are won by
+// a newly added shard, change their postfix.
+func (r *rendezvousKeyWrapper) ResetShardIDs(ids []string) {
+	hashes := make([]uint64, len(ids))
+	for i, id := range ids {
+		hashes[i] = hashKey(id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ids = ids
+	r.idHashes = hashes
+}
+
+// WrapKey wraps the given key with the identifier of the shard
+// that scores highest for it.
+// Without any shard identifiers it always appends ":1".
+// Example: "user:123" -> "user:123:redis-b"
+func (r *rendezvousKeyWrapper) WrapKey(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.ids) == 0 {
+		return r.format.wrap(key, 1)
+	}
+
+	keyHash := hashKey(key)
+
+	var (
+		best      int
+		bestScore uint64
+	)
+
+	for i, idHash := range r.idHashes {
+		score := mixHash(keyHash ^ idHash)
+		if i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return r.format.JoinKey(key, r.ids[best])
+}
+
+// mixHash is the 64-bit finalizer of MurmurHash3. It spreads the bits of
+// the combined key and shard hashes so that scores are independent per shard.
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+// defaultShardIDs returns the identifiers "1".."count" matching the postfixes
+// of the counter based wrappers. It is used for named wrappers until explicit
+// shard identifiers are provided.
+func defaultShardIDs(count int) []string {
+	if count < 1 {
+		count = 1
+	}
+
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+
+	return ids
+}
@@ -0,0 +1,135 @@
+package key_wrapper
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRendezvousKeyWrapper_WrapKey(t *testing.T) {
+	t.Run("stable for the same key", func(t *testing.T) {
+		kw := newRendezvousKeyWrapper([]string{"a", "b", "c"}, Formatter{})
+
+		exp := kw.WrapKey("user:123")
+		for i := 0; i < 100; i++ {
+			got := kw.WrapKey("user:123")
+			if got != exp {
+				t.Fatalf("got=%s != exp=%s", got, exp)
+			}
+		}
+	})
+
+	t.Run("removing a shard remaps only its keys", func(t *testing.T) {
+		kw := newRendezvousKeyWrapper([]string{"1", "2", "3", "4", "5"}, Formatter{})
+
+		before := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := "user:" + strconv.Itoa(i)
+			before[key] = kw.WrapKey(key)
+		}
+
+		kw.ResetShardIDs([]string{"1", "2", "4", "5"})
+
+		var moved int
+		for key, wrapped := range before {
+			got := kw.WrapKey(key)
+			if got == wrapped {
+				continue
+			}
+
+			if wrapped != key+":3" {
+				t.Fatalf("key %s moved from %s to %s", key, wrapped, got)
+			}
+
+			moved++
+		}
+
+		if moved == 0 {
+			t.Fatal("expected keys of the removed shard to move")
+		}
+	})
+
+	t.Run("uses every shard", func(t *testing.T) {
+		ids := []string{"redis-a", "redis-b", "redis-c"}
+		kw := newRendezvousKeyWrapper(ids, Formatter{})
+
+		seen := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			key := "user:" + strconv.Itoa(i)
+			seen[strings.TrimPrefix(kw.WrapKey(key), key+":")] = true
+		}
+
+		for _, id := range ids {
+			if !seen[id] {
+				t.Fatalf("shard %s was never used", id)
+			}
+		}
+	})
+}
+
+func TestFactory_MakeRendezvousKeyWrapper(t *testing.T) {
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeRendezvousKeyWrapper()
+
+	if got := w.WrapKey("key"); got != "key:1" {
+		t.Fatalf("got=%s, exp=key:1", got)
+	}
+
+	// default IDs follow the shard count until explicit IDs are set
+	if err := f.compareAndUpdate(3); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	exp := newRendezvousKeyWrapper([]string{"1", "2", "3"}, Formatter{}).WrapKey("user:1")
+	if got := w.WrapKey("user:1"); got != exp {
+		t.Fatalf("got=%s, exp=%s", got, exp)
+	}
+
+	if err := f.compareAndUpdateShardIDs([]string{"only"}); err != nil {
+		t.Fatalf("compareAndUpdateShardIDs: %v", err)
+	}
+
+	if got := w.WrapKey("user:1"); got != "user:1:only" {
+		t.Fatalf("got=%s, exp=user:1:only", got)
+	}
+
+	// explicit IDs are no longer replaced by count updates
+	if err := f.compareAndUpdate(5); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	if got := w.WrapKey("user:1"); got != "user:1:only" {
+		t.Fatalf("got=%s, exp=user:1:only", got)
+	}
+
+	stats := f.Stats()
+	if stats.NamedWrappers != 1 {
+		t.Fatalf("expected 1 named wrapper, got %d", stats.NamedWrappers)
+	}
+
+	if len(stats.ShardIDs) != 1 || stats.ShardIDs[0] != "only" {
+		t.Fatalf("unexpected shard IDs: %v", stats.ShardIDs)
+	}
+}
+
+func TestValidateShardIDs(t *testing.T) {
+	invalid := map[string][]string{
+		"empty list": {},
+		"empty ID":   {"a", ""},
+		"duplicate":  {"a", "b", "a"},
+	}
+
+	for name, ids := range invalid {
+		if err := validateShardIDs(ids); err == nil {
+			t.Fatalf("%s: expected error, got nil", name)
+		}
+	}
+
+	if err := validateShardIDs([]string{"a", "b"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
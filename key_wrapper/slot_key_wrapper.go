@@ -0,0 +1,176 @@
+package key_wrapper
+
+import (
+	"sync"
+)
+
+const (
+	// defaultSlotsCount defines the default number of logical slots
+	// keys are hashed into by slot wrappers.
+	defaultSlotsCount = 1024
+	// maxSlotsCount defines the maximum allowed number of logical slots.
+	maxSlotsCount = 65_536
+)
+
+// SlotChange describes a logical slot that was moved to another shard
+// by a slot table update.
+type SlotChange struct {
+	Slot int // logical slot index, from 0 to slots count - 1
+	From int // shard number that owned the slot before the update
+	To   int // shard number that owns the slot after the update
+}
+
+// ResetSlotTable defines the interface for objects that can have their
+// slot-to-shard table updated. This interface is used by the factory
+// to update all registered slot wrappers when the table changes.
+type ResetSlotTable interface {
+	// ResetSlotTable updates the slot table to the specified one.
+	// table[slot] is the shard number owning the slot.
+	ResetSlotTable(table []int)
+}
+
+// SlotKeyWrapper is a KeyWrapper over logical slots that can also
+// locate keys of slots that are being migrated between shards.
+type SlotKeyWrapper interface {
+	KeyWrapper
+	// LocateKey returns the slot of the key, its migration state and
+	// the wrapped keys on the source and target shards of the slot.
+	LocateKey(key string) KeyLocation
+}
+
+// KeyLocation describes where a key of a slot wrapper lives.
+// For a stable slot Source and Target are the same wrapped key.
+// While the slot is migrating, readers should read Target first
+// and fall back to Source if the key is not there yet.
+type KeyLocation struct {
+	Slot   int       // logical slot of the key
+	State  SlotState // migration state of the slot
+	Source string    // wrapped key on the shard the slot moves from
+	Target string    // wrapped key on the shard the slot moves to
+}
+
+// Compile-time interface compliance checks
+var _ SlotKeyWrapper = (*slotKeyWrapper)(nil)
+var _ ResetSlotTable = (*slotKeyWrapper)(nil)
+var _ ResetSlotMigrations = (*slotKeyWrapper)(nil)
+
+// slotKeyWrapper is a KeyWrapper that hashes keys into a fixed number of
+// logical slots and maps every slot to a physical shard through a slot table.
+// Resharding moves slots between shards instead of changing the modulus,
+// so only keys of the moved slots change their postfix.
+type slotKeyWrapper struct {
+	mu         sync.RWMutex          // protects table and migrations from concurrent access
+	table      []int                 // shard number of every slot, index is the slot
+	migrations map[int]SlotMigration // in-flight migrations keyed by slot
+	format     Formatter             // renders shard postfixes
+}
+
+// newSlotKeyWrapper creates a new slotKeyWrapper instance with the
+// specified slot table, in-flight migrations and postfix format.
+func newSlotKeyWrapper(table []int, migrations map[int]SlotMigration, format Formatter) *slotKeyWrapper {
+	w := &slotKeyWrapper{format: format}
+	w.ResetSlotTable(table)
+	w.ResetSlotMigrations(migrations)
+
+	return w
+}
+
+// ResetSlotTable updates the slot table for this wrapper.
+// Keys of slots that kept their shard keep their postfix.
+func (s *slotKeyWrapper) ResetSlotTable(table []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.table = table
+}
+
+// ResetSlotMigrations updates the in-flight migrations for this wrapper.
+// Keys of migrating slots are written to the source shard,
+// keys of importing slots are written to the target shard.
+func (s *slotKeyWrapper) ResetSlotMigrations(migrations map[int]SlotMigration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.migrations = migrations
+}
+
+// WrapKey wraps the given key with the postfix of the shard
+// writes of the key's slot go to.
+// Example: "user:123" -> slot 517 -> "user:123:2"
+func (s *slotKeyWrapper) WrapKey(key string) string {
+	loc := s.LocateKey(key)
+
+	if loc.State == SlotImporting {
+		return loc.Target
+	}
+
+	return loc.Source
+}
+
+// LocateKey returns where the key lives according to the slot table
+// and the in-flight migrations.
+// Example: "user:123" in slot 517 migrating from shard 2 to shard 5 ->
+// {Slot: 517, State: SlotMigrating, Source: "user:123:2", Target: "user:123:5"}
+func (s *slotKeyWrapper) LocateKey(key string) KeyLocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.table) == 0 {
+		wrapped := s.format.wrap(key, 1)
+		return KeyLocation{Source: wrapped, Target: wrapped}
+	}
+
+	slot := keySlot(key, len(s.table))
+
+	m, ok := s.migrations[slot]
+	if !ok {
+		wrapped := s.format.wrap(key, s.table[slot])
+		return KeyLocation{Slot: slot, Source: wrapped, Target: wrapped}
+	}
+
+	return KeyLocation{
+		Slot:   slot,
+		State:  m.State,
+		Source: s.format.wrap(key, m.Source),
+		Target: s.format.wrap(key, m.Target),
+	}
+}
+
+// keySlot returns the logical slot of the key for the given number of slots.
+func keySlot(key string, slotsCount int) int {
+	return int(hashKey(key) % uint64(slotsCount))
+}
+
+// defaultSlotTable returns a slot table that splits the slots into count
+// contiguous ranges of equal size, the first range owned by shard 1.
+// It is used for slot wrappers until an explicit table is provided.
+func defaultSlotTable(slotsCount, count int) []int {
+	if count < 1 {
+		count = 1
+	}
+
+	table := make([]int, slotsCount)
+	for slot := range table {
+		table[slot] = slot*count/slotsCount + 1
+	}
+
+	return table
+}
+
+// diffSlotTables returns the slots whose shard differs between
+// the old and the new table. Both tables must have the same length.
+func diffSlotTables(old, new []int) []SlotChange {
+	var changes []SlotChange
+
+	for slot := range new {
+		if old[slot] != new[slot] {
+			changes = append(changes, SlotChange{
+				Slot: slot,
+				From: old[slot],
+				To:   new[slot],
+			})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,149 @@
+package key_wrapper
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDefaultSlotTable(t *testing.T) {
+	table := defaultSlotTable(8, 3)
+
+	exp := []int{1, 1, 1, 2, 2, 2, 3, 3}
+	if !equalInts(table, exp) {
+		t.Fatalf("got=%v, exp=%v", table, exp)
+	}
+
+	table = defaultSlotTable(4, 0)
+
+	exp = []int{1, 1, 1, 1}
+	if !equalInts(table, exp) {
+		t.Fatalf("got=%v, exp=%v", table, exp)
+	}
+}
+
+func TestSlotKeyWrapper_WrapKey(t *testing.T) {
+	const slotsCount = 16
+
+	table := defaultSlotTable(slotsCount, 4)
+	kw := newSlotKeyWrapper(table, nil, Formatter{})
+
+	for i := 0; i < 100; i++ {
+		key := "user:" + strconv.Itoa(i)
+		exp := key + ":" + strconv.Itoa(table[keySlot(key, slotsCount)])
+
+		if got := kw.WrapKey(key); got != exp {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	}
+
+	// moving one slot only changes keys of that slot
+	const movedSlot = 3
+
+	moved := make([]int, slotsCount)
+	copy(moved, table)
+	moved[movedSlot] = 4
+
+	before := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := "user:" + strconv.Itoa(i)
+		before[key] = kw.WrapKey(key)
+	}
+
+	kw.ResetSlotTable(moved)
+
+	for key, wrapped := range before {
+		got := kw.WrapKey(key)
+
+		if keySlot(key, slotsCount) == movedSlot {
+			if got != key+":4" {
+				t.Fatalf("got=%s, exp=%s", got, key+":4")
+			}
+			continue
+		}
+
+		if got != wrapped {
+			t.Fatalf("key of unmoved slot changed: %s -> %s", wrapped, got)
+		}
+	}
+}
+
+func TestFactory_MakeSlotKeyWrapper(t *testing.T) {
+	const slotsCount = 8
+
+	f, err := NewFactory(2, WithSlotsCount(slotsCount))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeSlotKeyWrapper()
+
+	const key = "user:123"
+	slot := f.KeySlot(key)
+
+	exp := key + ":" + strconv.Itoa(defaultSlotTable(slotsCount, 2)[slot])
+	if got := w.WrapKey(key); got != exp {
+		t.Fatalf("got=%s, exp=%s", got, exp)
+	}
+
+	if changes := f.SlotChanges(); changes != nil {
+		t.Fatalf("expected no slot changes, got %v", changes)
+	}
+
+	// without a slot table the default ranges follow the shard count
+	if err := f.compareAndUpdate(4); err != nil {
+		t.Fatalf("compareAndUpdate: %v", err)
+	}
+
+	expChanges := diffSlotTables(defaultSlotTable(slotsCount, 2), defaultSlotTable(slotsCount, 4))
+	if changes := f.SlotChanges(); len(changes) != len(expChanges) {
+		t.Fatalf("got=%v, exp=%v", changes, expChanges)
+	}
+
+	table := []int{1, 1, 2, 2, 3, 3, 4, 4}
+	table[slot] = 7
+
+	if err := f.compareAndUpdateSlotTable(table); err != nil {
+		t.Fatalf("compareAndUpdateSlotTable: %v", err)
+	}
+
+	if got := w.WrapKey(key); got != key+":7" {
+		t.Fatalf("got=%s, exp=%s", got, key+":7")
+	}
+
+	changes := f.SlotChanges()
+	if len(changes) != 1 || changes[0].Slot != slot || changes[0].To != 7 {
+		t.Fatalf("unexpected slot changes: %v", changes)
+	}
+
+	stats := f.Stats()
+	if stats.SlotWrappers != 1 || stats.Slots != slotsCount {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if err := f.compareAndUpdateSlotTable([]int{1, 2}); err == nil {
+		t.Fatal("expected error for wrong table length, got nil")
+	}
+
+	if err := f.compareAndUpdateSlotTable(make([]int, slotsCount)); err == nil {
+		t.Fatal("expected error for invalid shard number, got nil")
+	}
+}
+
+func TestWithSlotsCount(t *testing.T) {
+	if _, err := NewFactory(1, WithSlotsCount(0)); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if _, err := NewFactory(1, WithSlotsCount(maxSlotsCount+1)); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	if f.Stats().Slots != defaultSlotsCount {
+		t.Fatalf("expected %d slots, got %d", defaultSlotsCount, f.Stats().Slots)
+	}
+}
@@ -0,0 +1,181 @@
+package key_wrapper
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SlotState is the migration state of a logical slot.
+type SlotState int
+
+const (
+	// SlotStable means the slot is owned by a single shard.
+	SlotStable SlotState = iota
+	// SlotMigrating means the slot is being copied to the target shard.
+	// Writes still go to the source shard; readers should try the target
+	// shard and fall back to the source shard.
+	SlotMigrating
+	// SlotImporting means the target shard has taken over the slot.
+	// Writes go to the target shard; readers should try the target shard
+	// and fall back to the source shard until the migration completes.
+	SlotImporting
+)
+
+// String returns the name of the slot state.
+func (s SlotState) String() string {
+	switch s {
+	case SlotStable:
+		return "stable"
+	case SlotMigrating:
+		return "migrating"
+	case SlotImporting:
+		return "importing"
+	default:
+		return fmt.Sprintf("SlotState(%d)", int(s))
+	}
+}
+
+// SlotMigration describes a logical slot that is moving between shards.
+//
+// A migration starts in SlotMigrating, moves to SlotImporting and completes
+// when the slot is no longer reported: the target shard then becomes the owner
+// of the slot in the slot table. A slot that disappears while still in
+// SlotMigrating is considered aborted and stays on the source shard.
+type SlotMigration struct {
+	Slot   int       // logical slot index, from 0 to slots count - 1
+	Source int       // shard number the slot moves from; filled from the slot table when zero
+	Target int       // shard number the slot moves to
+	State  SlotState // SlotMigrating or SlotImporting
+}
+
+// SlotTransitionError is returned when a slot migration update
+// requests a state transition that is not allowed.
+type SlotTransitionError struct {
+	Slot int       // logical slot index
+	From SlotState // current state of the slot
+	To   SlotState // requested state of the slot
+}
+
+// Error implements the error interface.
+func (e *SlotTransitionError) Error() string {
+	return fmt.Sprintf("slot %d: invalid transition from %s to %s",
+		e.Slot, e.From, e.To)
+}
+
+// ResetSlotMigrations defines the interface for objects that can have their
+// set of in-flight slot migrations updated. This interface is used by the
+// factory to update all registered slot wrappers when migrations change.
+type ResetSlotMigrations interface {
+	// ResetSlotMigrations updates the in-flight migrations, keyed by slot.
+	ResetSlotMigrations(migrations map[int]SlotMigration)
+}
+
+// validSlotTransition reports whether a slot may move from one state to another.
+// The allowed transitions are stable -> migrating -> importing -> stable,
+// and migrating -> stable to abort a migration.
+func validSlotTransition(from, to SlotState) bool {
+	switch from {
+	case SlotStable:
+		return to == SlotStable || to == SlotMigrating
+	case SlotMigrating:
+		return to == SlotStable || to == SlotMigrating || to == SlotImporting
+	case SlotImporting:
+		return to == SlotStable || to == SlotImporting
+	default:
+		return false
+	}
+}
+
+// nextSlotMigrations validates the requested migrations against the current
+// ones and the slot table, and returns the new set of in-flight migrations.
+// Source shards of new migrations are taken from the slot table.
+func nextSlotMigrations(
+	current map[int]SlotMigration,
+	requested []SlotMigration,
+	table []int,
+) (map[int]SlotMigration, error) {
+	next := make(map[int]SlotMigration, len(requested))
+
+	for _, m := range requested {
+		if m.Slot < 0 || m.Slot >= len(table) {
+			return nil, fmt.Errorf("slot must be between 0 and %d, got %d",
+				len(table)-1, m.Slot)
+		}
+
+		if _, ok := next[m.Slot]; ok {
+			return nil, fmt.Errorf("duplicate migration of slot %d", m.Slot)
+		}
+
+		if m.Target < 1 || m.Target > maxShardsCount {
+			return nil, fmt.Errorf("slot %d target shard must be between 1 and %d, got %d",
+				m.Slot, maxShardsCount, m.Target)
+		}
+
+		prev, inFlight := current[m.Slot]
+		if !inFlight {
+			prev = SlotMigration{
+				Slot:   m.Slot,
+				Source: table[m.Slot],
+				Target: m.Target,
+				State:  SlotStable,
+			}
+
+			if prev.Source == m.Target {
+				return nil, fmt.Errorf("slot %d is already owned by shard %d",
+					m.Slot, m.Target)
+			}
+		}
+
+		if m.State == SlotStable || !validSlotTransition(prev.State, m.State) {
+			return nil, &SlotTransitionError{Slot: m.Slot, From: prev.State, To: m.State}
+		}
+
+		if m.Target != prev.Target {
+			return nil, fmt.Errorf("slot %d is migrating to shard %d, got target %d",
+				m.Slot, prev.Target, m.Target)
+		}
+
+		if m.Source != 0 && m.Source != prev.Source {
+			return nil, fmt.Errorf("slot %d is migrating from shard %d, got source %d",
+				m.Slot, prev.Source, m.Source)
+		}
+
+		next[m.Slot] = SlotMigration{
+			Slot:   m.Slot,
+			Source: prev.Source,
+			Target: prev.Target,
+			State:  m.State,
+		}
+	}
+
+	return next, nil
+}
+
+// equalSlotMigrations reports whether a and b contain the same migrations.
+func equalSlotMigrations(a, b map[int]SlotMigration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for slot, m := range a {
+		if other, ok := b[slot]; !ok || other != m {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortedSlotMigrations returns the migrations ordered by slot.
+func sortedSlotMigrations(migrations map[int]SlotMigration) []SlotMigration {
+	sorted := make([]SlotMigration, 0, len(migrations))
+	for _, m := range migrations {
+		sorted = append(sorted, m)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Slot < sorted[j].Slot
+	})
+
+	return sorted
+}
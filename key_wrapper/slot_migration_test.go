@@ -0,0 +1,185 @@
+package key_wrapper
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestValidSlotTransition(t *testing.T) {
+	allowed := map[[2]SlotState]bool{
+		{SlotStable, SlotStable}:       true,
+		{SlotStable, SlotMigrating}:    true,
+		{SlotStable, SlotImporting}:    false,
+		{SlotMigrating, SlotStable}:    true,
+		{SlotMigrating, SlotMigrating}: true,
+		{SlotMigrating, SlotImporting}: true,
+		{SlotImporting, SlotStable}:    true,
+		{SlotImporting, SlotMigrating}: false,
+		{SlotImporting, SlotImporting}: true,
+	}
+
+	for transition, exp := range allowed {
+		if got := validSlotTransition(transition[0], transition[1]); got != exp {
+			t.Fatalf("%s -> %s: got=%v, exp=%v", transition[0], transition[1], got, exp)
+		}
+	}
+}
+
+func TestFactory_SlotMigrations(t *testing.T) {
+	const slotsCount = 4
+
+	f, err := NewFactory(2, WithSlotsCount(slotsCount))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeSlotKeyWrapper()
+
+	// find a key in slot 0, owned by shard 1
+	var key string
+	for i := 0; ; i++ {
+		key = "user:" + strconv.Itoa(i)
+		if f.KeySlot(key) == 0 {
+			break
+		}
+	}
+
+	loc := w.LocateKey(key)
+	if loc.State != SlotStable || loc.Source != key+":1" || loc.Target != key+":1" {
+		t.Fatalf("unexpected location: %+v", loc)
+	}
+
+	t.Run("importing requires migrating first", func(t *testing.T) {
+		err := f.compareAndUpdateSlotMigrations([]SlotMigration{
+			{Slot: 0, Target: 2, State: SlotImporting},
+		})
+
+		var transitionErr *SlotTransitionError
+		if !errors.As(err, &transitionErr) {
+			t.Fatalf("expected SlotTransitionError, got %v", err)
+		}
+
+		if transitionErr.From != SlotStable || transitionErr.To != SlotImporting {
+			t.Fatalf("unexpected transition error: %v", transitionErr)
+		}
+	})
+
+	t.Run("migrating", func(t *testing.T) {
+		err := f.compareAndUpdateSlotMigrations([]SlotMigration{
+			{Slot: 0, Target: 2, State: SlotMigrating},
+		})
+		if err != nil {
+			t.Fatalf("compareAndUpdateSlotMigrations: %v", err)
+		}
+
+		loc := w.LocateKey(key)
+		if loc.State != SlotMigrating || loc.Source != key+":1" || loc.Target != key+":2" {
+			t.Fatalf("unexpected location: %+v", loc)
+		}
+
+		// writes stay on the source shard
+		if got := w.WrapKey(key); got != key+":1" {
+			t.Fatalf("got=%s, exp=%s", got, key+":1")
+		}
+
+		if stats := f.Stats(); stats.MigratingSlots != 1 || stats.ImportingSlots != 0 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("target can not change", func(t *testing.T) {
+		err := f.compareAndUpdateSlotMigrations([]SlotMigration{
+			{Slot: 0, Target: 3, State: SlotImporting},
+		})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("importing", func(t *testing.T) {
+		err := f.compareAndUpdateSlotMigrations([]SlotMigration{
+			{Slot: 0, Source: 1, Target: 2, State: SlotImporting},
+		})
+		if err != nil {
+			t.Fatalf("compareAndUpdateSlotMigrations: %v", err)
+		}
+
+		// writes go to the target shard
+		if got := w.WrapKey(key); got != key+":2" {
+			t.Fatalf("got=%s, exp=%s", got, key+":2")
+		}
+
+		migrations := f.SlotMigrations()
+		if len(migrations) != 1 || migrations[0].State != SlotImporting || migrations[0].Source != 1 {
+			t.Fatalf("unexpected migrations: %+v", migrations)
+		}
+	})
+
+	t.Run("importing can not go back to migrating", func(t *testing.T) {
+		err := f.compareAndUpdateSlotMigrations([]SlotMigration{
+			{Slot: 0, Target: 2, State: SlotMigrating},
+		})
+
+		var transitionErr *SlotTransitionError
+		if !errors.As(err, &transitionErr) {
+			t.Fatalf("expected SlotTransitionError, got %v", err)
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		if err := f.compareAndUpdateSlotMigrations(nil); err != nil {
+			t.Fatalf("compareAndUpdateSlotMigrations: %v", err)
+		}
+
+		loc := w.LocateKey(key)
+		if loc.State != SlotStable || loc.Source != key+":2" || loc.Target != key+":2" {
+			t.Fatalf("unexpected location: %+v", loc)
+		}
+
+		changes := f.SlotChanges()
+		if len(changes) != 1 || changes[0] != (SlotChange{Slot: 0, From: 1, To: 2}) {
+			t.Fatalf("unexpected slot changes: %+v", changes)
+		}
+
+		if len(f.SlotMigrations()) != 0 {
+			t.Fatalf("expected no migrations, got %+v", f.SlotMigrations())
+		}
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		err := f.compareAndUpdateSlotMigrations([]SlotMigration{
+			{Slot: 0, Target: 1, State: SlotMigrating},
+		})
+		if err != nil {
+			t.Fatalf("compareAndUpdateSlotMigrations: %v", err)
+		}
+
+		if err := f.compareAndUpdateSlotMigrations(nil); err != nil {
+			t.Fatalf("compareAndUpdateSlotMigrations: %v", err)
+		}
+
+		if got := w.WrapKey(key); got != key+":2" {
+			t.Fatalf("got=%s, exp=%s", got, key+":2")
+		}
+	})
+
+	t.Run("default table follows shard count changes", func(t *testing.T) {
+		if f.slotTable != nil {
+			t.Fatalf("completed migration set an explicit slot table: %v", f.slotTable)
+		}
+
+		if err := f.compareAndUpdate(1); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		// the moved slot returns to the default layout
+		if got := w.WrapKey(key); got != key+":1" {
+			t.Fatalf("got=%s, exp=%s", got, key+":1")
+		}
+
+		if got := f.ReadShardsCount(); got != 1 {
+			t.Fatalf("got=%d, exp=1", got)
+		}
+	})
+}
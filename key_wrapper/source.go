@@ -0,0 +1,36 @@
+package key_wrapper
+
+import (
+	"context"
+)
+
+// ShardsCountSource provides the current number of shards.
+// The context is canceled when the Interrogator stops and carries the
+// deadline of Config.SourceTimeout, so implementations doing network calls
+// should pass it on to abort hung requests.
+type ShardsCountSource interface {
+	ShardsCount(ctx context.Context) (int, error)
+}
+
+// ShardsCountSourceFunc is an adapter to use an ordinary function
+// taking a context as a ShardsCountSource.
+type ShardsCountSourceFunc func(ctx context.Context) (int, error)
+
+// ShardsCount calls f(ctx).
+func (f ShardsCountSourceFunc) ShardsCount(ctx context.Context) (int, error) {
+	return f(ctx)
+}
+
+// ShardsCountFunc is an adapter to use a function without a context, such as
+// Config.GetShardsCount, as a ShardsCountSource. The function cannot be
+// canceled, so a call is only bounded by the function itself.
+type ShardsCountFunc func() (int, error)
+
+// ShardsCount calls f, ignoring the context.
+func (f ShardsCountFunc) ShardsCount(context.Context) (int, error) {
+	return f()
+}
+
+// Compile-time interface compliance checks
+var _ ShardsCountSource = ShardsCountSourceFunc(nil)
+var _ ShardsCountSource = ShardsCountFunc(nil)
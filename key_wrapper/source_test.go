@@ -0,0 +1,104 @@
+package key_wrapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInterrogator_ShardsCountSource(t *testing.T) {
+	t.Run("adapts GetShardsCount", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		cfg := &Config{
+			GetShardsCount: func() (int, error) { return 3, nil },
+			Factory:        f,
+			ErrorHandler:   func(err error) { t.Fatalf("unexpected error: %v", err) },
+		}
+
+		(&Interrogator{}).checkAndUpdate(context.Background(), cfg)
+
+		if got := f.Stats().Shards; got != 3 {
+			t.Fatalf("got=%d, exp=3", got)
+		}
+	})
+
+	t.Run("passes the context", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, 5)
+
+		cfg := &Config{
+			ShardsCountSource: ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+				return ctx.Value(ctxKey{}).(int), nil
+			}),
+			Factory:      f,
+			ErrorHandler: func(err error) { t.Fatalf("unexpected error: %v", err) },
+		}
+
+		(&Interrogator{}).checkAndUpdate(ctx, cfg)
+
+		if got := f.Stats().Shards; got != 5 {
+			t.Fatalf("got=%d, exp=5", got)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		var handled error
+		cfg := &Config{
+			ShardsCountSource: ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}),
+			Factory:       f,
+			SourceTimeout: time.Millisecond,
+			ErrorHandler:  func(err error) { handled = err },
+		}
+
+		_, failed := (&Interrogator{}).checkAndUpdate(context.Background(), cfg)
+		if !failed {
+			t.Fatal("expected failure")
+		}
+
+		if !errors.Is(handled, context.DeadlineExceeded) {
+			t.Fatalf("got=%v, exp=%v", handled, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("canceled on stop", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		cfg := &Config{
+			ShardsCountSource: ShardsCountSourceFunc(func(ctx context.Context) (int, error) {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}),
+			Factory:      f,
+			ErrorHandler: func(err error) { t.Fatalf("unexpected error: %v", err) },
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, failed := (&Interrogator{ctx: ctx}).checkAndUpdate(ctx, cfg)
+		if !failed {
+			t.Fatal("expected failure")
+		}
+	})
+}
@@ -8,22 +8,106 @@ type ResetShards interface {
 	ResetShardsCount(count int)
 }
 
+// resetSnapshot is implemented by the wrappers that follow the shard count.
+// The factory builds one immutable shard snapshot per shard count change
+// and stores the same pointer into every wrapper.
+type resetSnapshot interface {
+	ResetShards
+	resetSnapshot(snap *shardSnapshot)
+}
+
+// resetSlots is implemented by slot wrappers that follow both
+// the slot table and the in-flight slot migrations.
+type resetSlots interface {
+	ResetSlotTable
+	ResetSlotMigrations
+}
+
+// resetTagger is implemented by Redis Cluster wrappers. The factory
+// builds one immutable tagger per slot map change and stores the same
+// pointer into every wrapper.
+type resetTagger interface {
+	ResetClusterSlots
+	resetTagger(tagger *clusterTagger)
+}
+
+// Compile-time interface compliance checks of the wrappers in the factory's stores
+var _ resetSnapshot = (*keyWrapper)(nil)
+var _ resetSnapshot = (*hashKeyWrapper)(nil)
+var _ ResetShardIDs = (*rendezvousKeyWrapper)(nil)
+var _ ResetShardWeights = (*weightedKeyWrapper)(nil)
+var _ resetSlots = (*slotKeyWrapper)(nil)
+var _ resetTagger = (*redisClusterKeyWrapper)(nil)
+
+// store keeps the wrappers that follow one kind of factory setting, such as
+// the shard count or the slot table. All wrappers of a store are updated
+// with the same value, which the kind-specific apply function hands to
+// a single wrapper.
 type store struct {
-	wrappers []ResetShards
+	wrappers []interface{}
+	apply    func(w, value interface{}) // applies an update value to one wrapper
 }
 
-func newStore() *store {
+func newStore(apply func(w, value interface{})) *store {
 	return &store{
-		wrappers: []ResetShards{},
+		wrappers: []interface{}{},
+		apply:    apply,
 	}
 }
 
-func (s *store) add(rs ResetShards) {
-	s.wrappers = append(s.wrappers, rs)
+func (s *store) add(w interface{}) {
+	s.wrappers = append(s.wrappers, w)
+}
+
+func (s *store) remove(w interface{}) {
+	for i, stored := range s.wrappers {
+		if stored != w {
+			continue
+		}
+
+		// clear the last slot so the removed wrapper is not kept alive
+		last := len(s.wrappers) - 1
+		copy(s.wrappers[i:], s.wrappers[i+1:])
+		s.wrappers[last] = nil
+		s.wrappers = s.wrappers[:last]
+
+		return
+	}
 }
 
-func (s *store) update(count int) {
+func (s *store) update(value interface{}) {
 	for _, w := range s.wrappers {
-		w.ResetShardsCount(count)
+		s.apply(w, value)
 	}
 }
+
+// applySnapshot applies a *shardSnapshot to a resetSnapshot wrapper.
+func applySnapshot(w, value interface{}) {
+	w.(resetSnapshot).resetSnapshot(value.(*shardSnapshot))
+}
+
+// applyShardIDs applies sorted shard IDs to a ResetShardIDs wrapper.
+func applyShardIDs(w, value interface{}) {
+	w.(ResetShardIDs).ResetShardIDs(value.([]string))
+}
+
+// applyShardWeights applies shard weights to a ResetShardWeights wrapper.
+func applyShardWeights(w, value interface{}) {
+	w.(ResetShardWeights).ResetShardWeights(value.([]int))
+}
+
+// applySlots applies a slot table ([]int) or the in-flight slot migrations
+// (map[int]SlotMigration) to a resetSlots wrapper.
+func applySlots(w, value interface{}) {
+	switch value := value.(type) {
+	case []int:
+		w.(resetSlots).ResetSlotTable(value)
+	case map[int]SlotMigration:
+		w.(resetSlots).ResetSlotMigrations(value)
+	}
+}
+
+// applyTagger applies a *clusterTagger to a resetTagger wrapper.
+func applyTagger(w, value interface{}) {
+	w.(resetTagger).resetTagger(value.(*clusterTagger))
+}
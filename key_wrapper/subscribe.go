@@ -0,0 +1,221 @@
+package key_wrapper
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// WrapperKind is a set of wrapper kinds, used to tell which wrappers
+// were affected by a shard count change.
+type WrapperKind uint
+
+const (
+	// GeneralKind covers the wrappers created by MakeKeyWrapper,
+	// MakeHashKeyWrapper and MakeJumpHashKeyWrapper.
+	GeneralKind WrapperKind = 1 << iota
+	// GrowingKind covers the wrappers created by MakeOnlyGrowingKeyWrapper
+	// and MakeOnlyGrowingJumpHashKeyWrapper.
+	GrowingKind
+	// NamedKind covers the wrappers created by MakeRendezvousKeyWrapper.
+	NamedKind
+	// WeightedKind covers the wrappers created by MakeWeightedKeyWrapper.
+	WeightedKind
+	// SlotKind covers the wrappers created by MakeSlotKeyWrapper.
+	SlotKind
+)
+
+// wrapperKindNames are the names of the wrapper kinds in bit order.
+var wrapperKindNames = []string{"general", "growing", "named", "weighted", "slot"}
+
+// Has reports whether all kinds of k2 are in k.
+func (k WrapperKind) Has(k2 WrapperKind) bool {
+	return k&k2 == k2
+}
+
+// String returns the names of the kinds joined by "|", e.g. "general|growing".
+func (k WrapperKind) String() string {
+	var names []string
+	for i, name := range wrapperKindNames {
+		if k.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ShardChangeEvent describes a shard count change applied by the factory.
+type ShardChangeEvent struct {
+	OldShards int         // shard count before the change
+	NewShards int         // shard count after the change
+	Time      time.Time   // when the change was applied
+	Kinds     WrapperKind // wrapper kinds that were updated by the change
+}
+
+// subscription is the channel of a subscriber, accessed through functions
+// so shard and slot change subscriptions share delivery and cancellation.
+type subscription struct {
+	send  func(event interface{}) bool // sends the event if the channel has room
+	drop  func() bool                  // receives the oldest event if there is one
+	close func()                       // closes the channel
+	once  sync.Once
+}
+
+// Subscribe registers a subscriber of shard count changes and returns the
+// channel events are delivered on and a function that cancels the subscription
+// and closes the channel. buffer is the capacity of the channel, at least 1.
+//
+// Delivery never blocks the update path: when the channel is full, the oldest
+// undelivered event is dropped to make room for the new one, so a slow subscriber
+// always gets the latest change. Dropped events are counted in
+// FactoryStats.DroppedShardEvents; a subscriber that needs every transition
+// should use a buffer large enough for its processing delay.
+func (f *Factory) Subscribe(buffer int) (<-chan ShardChangeEvent, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	ch := make(chan ShardChangeEvent, buffer)
+
+	s := &subscription{
+		send: func(event interface{}) bool {
+			select {
+			case ch <- event.(ShardChangeEvent):
+				return true
+			default:
+				return false
+			}
+		},
+		drop: func() bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		},
+		close: func() { close(ch) },
+	}
+
+	return ch, f.subscribe(&f.subscriptions, s)
+}
+
+// subscribe adds s to the subscriptions in subs and returns the function
+// that cancels it: it removes s and closes its channel, once.
+func (f *Factory) subscribe(subs *[]*subscription, s *subscription) func() {
+	f.mu.Lock()
+	*subs = append(*subs, s)
+	f.mu.Unlock()
+
+	return func() {
+		s.once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			for i, sub := range *subs {
+				if sub == s {
+					*subs = append((*subs)[:i], (*subs)[i+1:]...)
+					break
+				}
+			}
+
+			s.close()
+		})
+	}
+}
+
+// deliver sends the event to the subscriber without blocking. When the channel
+// is full, the oldest event is dropped, unless the subscriber has just received
+// it, and the send is retried. It returns the number of dropped events.
+// The caller must hold f.mu, which also serializes the senders.
+func deliver(s *subscription, event interface{}) int {
+	var dropped int
+
+	for !s.send(event) {
+		if s.drop() {
+			dropped++
+		}
+	}
+
+	return dropped
+}
+
+// publish delivers the event to all subscribers without blocking.
+// The caller must hold f.mu.
+func (f *Factory) publish(event ShardChangeEvent) {
+	for _, s := range f.subscriptions {
+		f.droppedShardEvents += deliver(s, event)
+	}
+}
+
+// SlotChangeEvent describes the logical slots that changed owner
+// on a single slot table update.
+type SlotChangeEvent struct {
+	Changes []SlotChange // slots that changed owner, ordered by slot
+	Time    time.Time    // when the change was applied
+}
+
+// SubscribeSlotChanges registers a subscriber of slot table changes and returns
+// the channel events are delivered on and a function that cancels the subscription
+// and closes the channel. An event is published for every update that moves at
+// least one slot: an explicit slot table change, a completed slot migration or,
+// while no table is set, a shard count change. buffer is the capacity of the
+// channel, at least 1.
+//
+// Unlike SlotChanges, which only returns the moves of the last update, the events
+// carry the moves of every update. Delivery follows the rules of Subscribe: when
+// the channel is full, the oldest event is dropped and counted in
+// FactoryStats.DroppedSlotEvents.
+func (f *Factory) SubscribeSlotChanges(buffer int) (<-chan SlotChangeEvent, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	ch := make(chan SlotChangeEvent, buffer)
+
+	s := &subscription{
+		send: func(event interface{}) bool {
+			select {
+			case ch <- event.(SlotChangeEvent):
+				return true
+			default:
+				return false
+			}
+		},
+		drop: func() bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		},
+		close: func() { close(ch) },
+	}
+
+	return ch, f.subscribe(&f.slotSubscriptions, s)
+}
+
+// recordSlotChanges remembers the slots that changed owner between the tables
+// for SlotChanges and publishes them to the slot change subscribers.
+// The caller must hold f.mu.
+func (f *Factory) recordSlotChanges(oldTable, newTable []int) {
+	f.slotChanges = diffSlotTables(oldTable, newTable)
+	if len(f.slotChanges) == 0 {
+		return
+	}
+
+	now := f.clock.Now()
+
+	for _, s := range f.slotSubscriptions {
+		changes := make([]SlotChange, len(f.slotChanges))
+		copy(changes, f.slotChanges)
+
+		f.droppedSlotEvents += deliver(s, SlotChangeEvent{Changes: changes, Time: now})
+	}
+}
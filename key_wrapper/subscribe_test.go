@@ -0,0 +1,239 @@
+package key_wrapper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFactory_Subscribe(t *testing.T) {
+	t.Run("receives shard count changes", func(t *testing.T) {
+		f, err := NewFactory(2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := f.Subscribe(4)
+		defer cancel()
+
+		if err := f.compareAndUpdate(4); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		// unchanged counts are not published
+		if err := f.compareAndUpdate(4); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		if err := f.compareAndUpdate(3); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		ev := <-events
+		if ev.OldShards != 2 || ev.NewShards != 4 || ev.Time.IsZero() {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+
+		exp := GeneralKind | GrowingKind | NamedKind | WeightedKind | SlotKind
+		if ev.Kinds != exp {
+			t.Fatalf("got=%s, exp=%s", ev.Kinds, exp)
+		}
+
+		ev = <-events
+		if ev.OldShards != 4 || ev.NewShards != 3 || ev.Kinds.Has(GrowingKind) {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected event: %+v", ev)
+		default:
+		}
+	})
+
+	t.Run("explicit topology is not affected", func(t *testing.T) {
+		f, err := NewFactory(2)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		if err := f.compareAndUpdateShardIDs([]string{"a", "b"}); err != nil {
+			t.Fatalf("compareAndUpdateShardIDs: %v", err)
+		}
+
+		events, cancel := f.Subscribe(1)
+		defer cancel()
+
+		if err := f.compareAndUpdate(3); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		if ev := <-events; ev.Kinds.Has(NamedKind) {
+			t.Fatalf("got=%s, named wrappers must not be affected", ev.Kinds)
+		}
+	})
+
+	t.Run("slow subscriber keeps the latest change", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := f.Subscribe(2)
+		defer cancel()
+
+		for count := 2; count <= 5; count++ {
+			if err := f.compareAndUpdate(count); err != nil {
+				t.Fatalf("compareAndUpdate: %v", err)
+			}
+		}
+
+		if got := f.Stats().DroppedShardEvents; got != 2 {
+			t.Fatalf("got=%d dropped events, exp=2", got)
+		}
+
+		for _, exp := range []int{4, 5} {
+			if ev := <-events; ev.NewShards != exp {
+				t.Fatalf("got=%d, exp=%d", ev.NewShards, exp)
+			}
+		}
+	})
+
+	t.Run("cancel closes the channel", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := f.Subscribe(1)
+		if got := f.Stats().Subscribers; got != 1 {
+			t.Fatalf("got=%d subscribers, exp=1", got)
+		}
+
+		cancel()
+		cancel()
+
+		if _, ok := <-events; ok {
+			t.Fatal("expected closed channel")
+		}
+
+		if got := f.Stats().Subscribers; got != 0 {
+			t.Fatalf("got=%d subscribers, exp=0", got)
+		}
+
+		// updates after cancel do not panic on the closed channel
+		if err := f.compareAndUpdate(2); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+	})
+}
+
+func TestFactory_SubscribeSlotChanges(t *testing.T) {
+	t.Run("receives every move", func(t *testing.T) {
+		f, err := NewFactory(1, WithSlotsCount(4))
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := f.SubscribeSlotChanges(4)
+		defer cancel()
+
+		if err := f.compareAndUpdate(2); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+
+		if err := f.compareAndUpdateSlotTable([]int{2, 1, 2, 2}); err != nil {
+			t.Fatalf("compareAndUpdateSlotTable: %v", err)
+		}
+
+		// unchanged tables are not published
+		if err := f.compareAndUpdateSlotTable([]int{2, 1, 2, 2}); err != nil {
+			t.Fatalf("compareAndUpdateSlotTable: %v", err)
+		}
+
+		exp := [][]SlotChange{
+			{{Slot: 2, From: 1, To: 2}, {Slot: 3, From: 1, To: 2}},
+			{{Slot: 0, From: 1, To: 2}},
+		}
+
+		for i, changes := range exp {
+			ev := <-events
+			if !reflect.DeepEqual(ev.Changes, changes) || ev.Time.IsZero() {
+				t.Fatalf("event %d: got=%+v, exp=%+v", i, ev, changes)
+			}
+		}
+
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected event: %+v", ev)
+		default:
+		}
+	})
+
+	t.Run("slow subscriber keeps the latest change", func(t *testing.T) {
+		f, err := NewFactory(1, WithSlotsCount(4))
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := f.SubscribeSlotChanges(1)
+		defer cancel()
+
+		for count := 2; count <= 3; count++ {
+			if err := f.compareAndUpdate(count); err != nil {
+				t.Fatalf("compareAndUpdate: %v", err)
+			}
+		}
+
+		if got := f.Stats().DroppedSlotEvents; got != 1 {
+			t.Fatalf("got=%d dropped events, exp=1", got)
+		}
+
+		if ev := <-events; !reflect.DeepEqual(ev.Changes, f.SlotChanges()) {
+			t.Fatalf("got=%+v, exp=%+v", ev.Changes, f.SlotChanges())
+		}
+	})
+
+	t.Run("cancel closes the channel", func(t *testing.T) {
+		f, err := NewFactory(1)
+		if err != nil {
+			t.Fatalf("failed to create factory: %v", err)
+		}
+
+		events, cancel := f.SubscribeSlotChanges(1)
+		if got := f.Stats().SlotSubscribers; got != 1 {
+			t.Fatalf("got=%d subscribers, exp=1", got)
+		}
+
+		cancel()
+		cancel()
+
+		if _, ok := <-events; ok {
+			t.Fatal("expected closed channel")
+		}
+
+		if got := f.Stats().SlotSubscribers; got != 0 {
+			t.Fatalf("got=%d subscribers, exp=0", got)
+		}
+
+		// updates after cancel do not panic on the closed channel
+		if err := f.compareAndUpdate(2); err != nil {
+			t.Fatalf("compareAndUpdate: %v", err)
+		}
+	})
+}
+
+func TestWrapperKind_String(t *testing.T) {
+	tests := map[WrapperKind]string{
+		0:                          "none",
+		GeneralKind:                "general",
+		GeneralKind | GrowingKind:  "general|growing",
+		NamedKind | SlotKind:       "named|slot",
+		WeightedKind | GeneralKind: "general|weighted",
+	}
+
+	for kind, exp := range tests {
+		if got := kind.String(); got != exp {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	}
+}
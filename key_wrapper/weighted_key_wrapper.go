@@ -0,0 +1,155 @@
+package key_wrapper
+
+import (
+	"context"
+	"sync"
+)
+
+// ResetShardWeights defines the interface for objects that can have their
+// shard weights updated. This interface is used by the factory to update
+// all registered weighted wrappers when the weights change.
+type ResetShardWeights interface {
+	// ResetShardWeights updates the shard weights to the specified values.
+	// weights[i] is the weight of the shard with postfix ":i+1".
+	ResetShardWeights(weights []int)
+}
+
+// Compile-time interface compliance checks
+var _ KeyWrapper = (*weightedKeyWrapper)(nil)
+var _ ResetShardWeights = (*weightedKeyWrapper)(nil)
+
+// weightedKeyWrapper is a KeyWrapper that distributes keys over shards
+// proportionally to their weights using smooth weighted round-robin
+// (as in nginx). Heavier shards are picked more often, and picks of
+// the same shard are interleaved with the others instead of bursting.
+type weightedKeyWrapper struct {
+	mu      sync.Mutex // protects weights, current and total from concurrent access
+	weights []int      // weight of each shard, index i is shard i+1
+	current []int      // current effective weight of each shard
+	total   int        // sum of all weights
+	format  Formatter  // renders shard postfixes
+}
+
+// newWeightedKeyWrapper creates a new weightedKeyWrapper instance
+// with the specified weights and postfix format.
+func newWeightedKeyWrapper(weights []int, format Formatter) *weightedKeyWrapper {
+	w := &weightedKeyWrapper{format: format}
+	w.ResetShardWeights(weights)
+
+	return w
+}
+
+// ResetShardWeights updates the shard weights for this wrapper.
+// The smoothing state is reset, so the new weights apply from the next call.
+func (w *weightedKeyWrapper) ResetShardWeights(weights []int) {
+	var total int
+	for _, weight := range weights {
+		total += weight
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.weights = weights
+	w.current = make([]int, len(weights))
+	w.total = total
+}
+
+// nextShard picks the next shard number with smooth weighted round-robin:
+// every shard's current weight grows by its weight, the shard with the
+// largest current weight is picked and its current weight is lowered by the total.
+// Without positive weights it always returns 1.
+func (w *weightedKeyWrapper) nextShard() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.advance()
+}
+
+// advance picks the next shard number. The caller must hold w.mu.
+func (w *weightedKeyWrapper) advance() int {
+	if w.total <= 0 || len(w.weights) <= 1 {
+		return 1
+	}
+
+	best := 0
+	for i, weight := range w.weights {
+		w.current[i] += weight
+		if w.current[i] > w.current[best] {
+			best = i
+		}
+	}
+
+	w.current[best] -= w.total
+
+	return best + 1
+}
+
+// WrapKey wraps the given key with the postfix of the next shard
+// according to the shard weights.
+// Example: with weights [5 1 1] keys get ":1", ":1", ":2", ":1", ":3", ":1", ":1".
+func (w *weightedKeyWrapper) WrapKey(key string) string {
+	return w.format.wrap(key, w.nextShard())
+}
+
+// WrapKeys wraps a batch of keys under a single lock acquisition.
+// With BatchRotating every key gets the next shard by weight,
+// with BatchShared all keys get the same one.
+func (w *weightedKeyWrapper) WrapKeys(keys []string, mode BatchMode) []ShardKeys {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	shards := make([]int, len(keys))
+
+	w.mu.Lock()
+	if mode == BatchShared {
+		shard := w.advance()
+		for i := range shards {
+			shards[i] = shard
+		}
+	} else {
+		for i := range shards {
+			shards[i] = w.advance()
+		}
+	}
+	w.mu.Unlock()
+
+	return groupByShard(w.format, keys, shards)
+}
+
+// PinShard picks the next shard according to the shard weights
+// and pins it into a copy of ctx.
+func (w *weightedKeyWrapper) PinShard(ctx context.Context) context.Context {
+	return withPinnedShard(ctx, w, w.nextShard())
+}
+
+// WrapKeyContext wraps the given key with the shard pinned into ctx
+// by PinShard, or with the next shard by weight if there is no pin.
+// A pin above the current number of shards is mapped onto them.
+func (w *weightedKeyWrapper) WrapKeyContext(ctx context.Context, key string) string {
+	if shard, ok := pinnedShard(ctx, w); ok {
+		w.mu.Lock()
+		count := len(w.weights)
+		w.mu.Unlock()
+
+		return w.format.wrap(key, pinWithin(shard, count))
+	}
+
+	return w.WrapKey(key)
+}
+
+// defaultShardWeights returns equal weights for count shards.
+// It is used for weighted wrappers until explicit weights are provided.
+func defaultShardWeights(count int) []int {
+	if count < 1 {
+		count = 1
+	}
+
+	weights := make([]int, count)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	return weights
+}
@@ -0,0 +1,99 @@
+package key_wrapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWeightedKeyWrapper_WrapKey(t *testing.T) {
+	t.Run("smooth sequence", func(t *testing.T) {
+		kw := newWeightedKeyWrapper([]int{5, 1, 1}, Formatter{})
+
+		expectedPostfixes := []string{":1", ":1", ":2", ":1", ":3", ":1", ":1"}
+
+		for round := 0; round < 3; round++ {
+			for i, expectedPostfix := range expectedPostfixes {
+				result := kw.WrapKey("test")
+				expected := "test" + expectedPostfix
+
+				if result != expected {
+					t.Fatalf("round %d, iteration %d: expected %s, got %s", round, i, expected, result)
+				}
+			}
+		}
+	})
+
+	t.Run("proportional distribution", func(t *testing.T) {
+		weights := []int{1, 2, 0, 5}
+		kw := newWeightedKeyWrapper(weights, Formatter{})
+
+		counts := make(map[string]int)
+		for i := 0; i < 800; i++ {
+			counts[strings.TrimPrefix(kw.WrapKey("key"), "key")]++
+		}
+
+		expected := map[string]int{":1": 100, ":2": 200, ":4": 500}
+		for postfix, exp := range expected {
+			if counts[postfix] != exp {
+				t.Fatalf("postfix %s: expected %d, got %d", postfix, exp, counts[postfix])
+			}
+		}
+
+		if counts[":3"] != 0 {
+			t.Fatalf("shard with zero weight was used %d times", counts[":3"])
+		}
+	})
+
+	t.Run("single shard", func(t *testing.T) {
+		kw := newWeightedKeyWrapper([]int{3}, Formatter{})
+
+		for i := 0; i < 10; i++ {
+			if got := kw.WrapKey("key"); got != "key:1" {
+				t.Fatalf("got=%s, exp=key:1", got)
+			}
+		}
+	})
+}
+
+func TestFactory_MakeWeightedKeyWrapper(t *testing.T) {
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+
+	w := f.MakeWeightedKeyWrapper()
+
+	// equal weights while no weights are configured
+	for _, exp := range []string{"key:1", "key:2", "key:1", "key:2"} {
+		if got := w.WrapKey("key"); got != exp {
+			t.Fatalf("got=%s, exp=%s", got, exp)
+		}
+	}
+
+	if err := f.compareAndUpdateShardWeights([]int{0, 0, 1}); err != nil {
+		t.Fatalf("compareAndUpdateShardWeights: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := w.WrapKey("key"); got != "key:3" {
+			t.Fatalf("got=%s, exp=key:3", got)
+		}
+	}
+
+	stats := f.Stats()
+	if stats.WeightedWrappers != 1 {
+		t.Fatalf("expected 1 weighted wrapper, got %d", stats.WeightedWrappers)
+	}
+
+	if !equalInts(stats.Weights, []int{0, 0, 1}) {
+		t.Fatalf("unexpected weights: %v", stats.Weights)
+	}
+
+	if err := f.compareAndUpdateShardWeights([]int{0, 0}); err == nil {
+		t.Fatal("expected error for zero total weight, got nil")
+	}
+
+	if err := f.compareAndUpdateShardWeights([]int{1, -1}); err == nil {
+		t.Fatal("expected error for negative weight, got nil")
+	}
+}